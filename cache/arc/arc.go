@@ -0,0 +1,235 @@
+package arc
+
+import (
+	"cache/lru"
+	"container/list"
+)
+
+// ARC（Adaptive Replacement Cache）缓存：T1 保存只访问过一次的记录，T2 保存访问过多次的记录，
+// B1、B2 分别保存从 T1、T2 淘汰的 key（幽灵记录）。命中 B1 说明应该偏向最近访问，
+// 增大 T1 的目标大小 p；命中 B2 说明应该偏向访问频率，减小 p。
+// 所有大小按字节计算，B1、B2 只保存 key 和记录大小，不计入 maxBytes。当前非线程安全
+type Cache struct {
+	maxBytes int64
+	// T1 的目标字节数，在 [0, maxBytes] 之间自适应调整
+	p int64
+	// 四个队列的字节数
+	t1Bytes, t2Bytes, b1Bytes, b2Bytes int64
+	t1, t2, b1, b2                     *list.List
+	// 记录所在的 T1 或 T2 元素
+	cache map[string]*list.Element
+	// 幽灵记录所在的 B1 或 B2 元素
+	ghosts map[string]*list.Element
+	// 可选的方法（回调作用）
+	OnEvicted func(key string, value lru.Value)
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+	// 是否在 T2 中
+	frequent bool
+}
+
+type ghost struct {
+	key  string
+	size int64
+	// 是否在 B2 中
+	frequent bool
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        list.New(),
+		t2:        list.New(),
+		b1:        list.New(),
+		b2:        list.New(),
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 添加值到缓存中
+func (c *Cache) Add(key string, value lru.Value) {
+	size := int64(len(key)) + int64(value.Len())
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		old := int64(len(key)) + int64(kv.value.Len())
+		if kv.frequent {
+			c.t2Bytes += size - old
+		} else {
+			c.t1Bytes += size - old
+		}
+		kv.value = value
+		c.toFrequent(ele)
+		c.evict(false)
+		return
+	}
+
+	kv := &entry{key: key, value: value}
+	hitB2 := false
+	if ele, ok := c.ghosts[key]; ok {
+		g := ele.Value.(*ghost)
+		if g.frequent {
+			// 命中 B2：偏向访问频率，减小 T1 的目标大小
+			c.p -= max(g.size, g.size*c.b1Bytes/max(c.b2Bytes, 1))
+			if c.p < 0 {
+				c.p = 0
+			}
+			hitB2 = true
+		} else {
+			// 命中 B1：偏向最近访问，增大 T1 的目标大小
+			c.p += max(g.size, g.size*c.b2Bytes/max(c.b1Bytes, 1))
+			if c.maxBytes != 0 && c.p > c.maxBytes {
+				c.p = c.maxBytes
+			}
+		}
+		c.removeGhost(ele)
+		kv.frequent = true
+		c.cache[key] = c.t2.PushFront(kv)
+		c.t2Bytes += size
+	} else {
+		c.cache[key] = c.t1.PushFront(kv)
+		c.t1Bytes += size
+	}
+	c.evict(hitB2)
+}
+
+// 从缓存中获取值，命中的记录移动到 T2 的队头
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		c.toFrequent(ele)
+		return c.cache[key].Value.(*entry).value, true
+	}
+	return
+}
+
+// 按 ARC 的规则淘汰一条记录：T1 超过目标大小时淘汰 T1，否则淘汰 T2
+func (c *Cache) RemoveOldest() {
+	c.replace(false)
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+	if ele, ok := c.ghosts[key]; ok {
+		c.removeGhost(ele)
+	}
+}
+
+// 先遍历 T2 再遍历 T1，均从最近使用到最久未使用，f 返回 false 时停止。
+// 调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value lru.Value) bool) {
+	for _, l := range []*list.List{c.t2, c.t1} {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if !f(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// 缓存中的记录数，不包括幽灵记录
+func (c *Cache) Len() int {
+	return c.t1.Len() + c.t2.Len()
+}
+
+func (c *Cache) evict(hitB2 bool) {
+	for c.maxBytes != 0 && c.maxBytes < c.t1Bytes+c.t2Bytes {
+		c.replace(hitB2)
+	}
+	// 幽灵记录总量不超过 maxBytes，且 T1+B1 不超过 maxBytes
+	for c.maxBytes != 0 && c.b1.Len() > 0 && c.t1Bytes+c.b1Bytes > c.maxBytes {
+		c.removeGhost(c.b1.Back())
+	}
+	for c.maxBytes != 0 && c.b2.Len() > 0 && c.b1Bytes+c.b2Bytes > c.maxBytes {
+		c.removeGhost(c.b2.Back())
+	}
+}
+
+func (c *Cache) replace(hitB2 bool) {
+	if c.t1.Len() > 0 && (c.t1Bytes > c.p || (hitB2 && c.t1Bytes == c.p) || c.t2.Len() == 0) {
+		ele := c.t1.Back()
+		c.removeElement(ele)
+		c.addGhost(ele.Value.(*entry), c.b1)
+		return
+	}
+	if ele := c.t2.Back(); ele != nil {
+		c.removeElement(ele)
+		c.addGhost(ele.Value.(*entry), c.b2)
+	}
+}
+
+// 将记录移动到 T2 的队头
+func (c *Cache) toFrequent(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.frequent {
+		c.t2.MoveToFront(ele)
+		return
+	}
+	size := int64(len(kv.key)) + int64(kv.value.Len())
+	c.t1.Remove(ele)
+	c.t1Bytes -= size
+	kv.frequent = true
+	c.cache[kv.key] = c.t2.PushFront(kv)
+	c.t2Bytes += size
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	size := int64(len(kv.key)) + int64(kv.value.Len())
+	if kv.frequent {
+		c.t2.Remove(ele)
+		c.t2Bytes -= size
+	} else {
+		c.t1.Remove(ele)
+		c.t1Bytes -= size
+	}
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) addGhost(kv *entry, l *list.List) {
+	g := &ghost{
+		key:      kv.key,
+		size:     int64(len(kv.key)) + int64(kv.value.Len()),
+		frequent: l == c.b2,
+	}
+	c.ghosts[kv.key] = l.PushFront(g)
+	if g.frequent {
+		c.b2Bytes += g.size
+	} else {
+		c.b1Bytes += g.size
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghost)
+	if g.frequent {
+		c.b2.Remove(ele)
+		c.b2Bytes -= g.size
+	} else {
+		c.b1.Remove(ele)
+		c.b1Bytes -= g.size
+	}
+	delete(c.ghosts, g.key)
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// T1 和 T2 中记录占用的总字节数，不包括幽灵记录
+func (c *Cache) Bytes() int64 {
+	return c.t1Bytes + c.t2Bytes
+}
@@ -0,0 +1,103 @@
+package arc
+
+import (
+	"cache/lru"
+	"fmt"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestEvictBounds(t *testing.T) {
+	evicted := 0
+	c := New(int64(60), func(key string, value lru.Value) {
+		evicted++
+	})
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("%05d", i)
+		c.Add(k, String("v"))
+		c.Get(k)
+	}
+	if c.t1Bytes+c.t2Bytes > 60 || c.Len() != 10 || evicted != 90 {
+		t.Fatalf("expect 10 entries within 60 bytes, but %d entries, %d bytes", c.Len(), c.t1Bytes+c.t2Bytes)
+	}
+	if c.b1Bytes+c.b2Bytes > 60 {
+		t.Fatalf("expect ghosts bounded by maxBytes, but %d got", c.b1Bytes+c.b2Bytes)
+	}
+}
+
+// cache 是 ARC 和 LRU 共同的接口
+type cache interface {
+	Add(key string, value lru.Value)
+	Get(key string) (lru.Value, bool)
+}
+
+// 读取 key，未命中时添加，返回是否命中
+func access(c cache, key string) bool {
+	if _, ok := c.Get(key); ok {
+		return true
+	}
+	c.Add(key, String("v"))
+	return false
+}
+
+// 先是只有最近访问局部性的阶段，再是热点集合与一次性扫描交替的阶段
+func mixedTrace() []string {
+	trace := make([]string, 0)
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 80; i++ {
+			trace = append(trace, fmt.Sprintf("r%04d", round*40+i))
+		}
+	}
+	scan := 0
+	for round := 0; round < 50; round++ {
+		for pass := 0; pass < 2; pass++ {
+			for i := 0; i < 60; i++ {
+				trace = append(trace, fmt.Sprintf("h%04d", i))
+			}
+		}
+		for i := 0; i < 100; i++ {
+			trace = append(trace, fmt.Sprintf("s%04d", scan))
+			scan++
+		}
+	}
+	return trace
+}
+
+func TestHitRateOnMixedTrace(t *testing.T) {
+	// 每条记录 6 字节，容量为 100 条记录
+	const capacity = 600
+	a := New(capacity, nil)
+	l := lru.New(capacity, nil)
+	trace := mixedTrace()
+
+	arcHits, lruHits := 0, 0
+	for _, key := range trace {
+		if access(a, key) {
+			arcHits++
+		}
+		if access(l, key) {
+			lruHits++
+		}
+	}
+	t.Logf("hit rate: arc %.3f, lru %.3f",
+		float64(arcHits)/float64(len(trace)), float64(lruHits)/float64(len(trace)))
+	if arcHits <= lruHits {
+		t.Fatalf("expect ARC hits (%d) > LRU hits (%d)", arcHits, lruHits)
+	}
+}
@@ -0,0 +1,76 @@
+package bloom
+
+import "sync"
+
+// Filter 是并发安全的布隆过滤器：判断不存在时一定不存在，判断存在时可能误判
+type Filter struct {
+	mu sync.RWMutex
+	// 位数组
+	bits []uint64
+	// 位数组长度
+	m uint32
+	// 每个 key 使用的哈希函数个数
+	k uint32
+}
+
+// 创建一个 m 位、使用 k 个哈希函数的布隆过滤器
+func New(m, k uint32) *Filter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (f *Filter) Add(key string) {
+	h1, h2 := hash(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := uint32(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		f.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+// 返回 false 表示 key 一定不存在
+func (f *Filter) MayContain(key string) bool {
+	h1, h2 := hash(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint32(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		if f.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 清空过滤器
+func (f *Filter) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+}
+
+// 使用 FNV-1a 64 位哈希的高低 32 位作为两个哈希值，通过 h1 + i*h2 模拟 k 个哈希函数
+func hash(key string) (uint32, uint32) {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return uint32(h), uint32(h>>32) | 1
+}
@@ -0,0 +1,37 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestNoFalseNegative(t *testing.T) {
+	f := New(1<<16, 4)
+	for i := 0; i < 5000; i++ {
+		f.Add("key" + strconv.Itoa(i))
+	}
+	for i := 0; i < 5000; i++ {
+		if !f.MayContain("key" + strconv.Itoa(i)) {
+			t.Fatalf("false negative for key%d", i)
+		}
+	}
+
+	misses := 0
+	for i := 5000; i < 10000; i++ {
+		if !f.MayContain("key" + strconv.Itoa(i)) {
+			misses++
+		}
+	}
+	if misses < 4500 {
+		t.Fatalf("false positive rate too high, only %d of 5000 rejected", misses)
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := New(1024, 3)
+	f.Add("Tom")
+	f.Reset()
+	if f.MayContain("Tom") {
+		t.Fatal("expect empty filter after reset")
+	}
+}
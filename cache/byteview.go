@@ -1,9 +1,24 @@
 package cache
 
+import "time"
+
 // 一个 ByteView 是一个不可变的 byte 数组
 type ByteView struct {
 	// 使用 byte 是为了支持任意的数据类型，如字符串或图片
 	b []byte
+	// 过期时间，零值表示永不过期
+	e time.Time
+	// 值的 Content-Type，为空表示未知
+	ct string
+	// 版本号，添加到缓存时分配，0 表示不是从缓存中读取的
+	v uint64
+	// 添加到缓存的时间，只在缓存设置了 maxAge 时记录
+	t time.Time
+}
+
+// 返回内容为 b 的拷贝的 ByteView，用于 Group.Do 等需要调用方提供值的场景
+func NewByteView(b []byte) ByteView {
+	return ByteView{b: cloneBytes(b)}
 }
 
 // 实现 Value 接口，即实现Len()方法。返回 byte 的长度
@@ -11,17 +26,43 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// 返回过期时间，零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// 返回值的 Content-Type，由 TypedGetter 提供，未知时为 application/octet-stream
+func (v ByteView) ContentType() string {
+	if v.ct == "" {
+		return "application/octet-stream"
+	}
+	return v.ct
+}
+
 // 以字节数组的形式返回 ByteView 的拷贝（只读，以拷贝的形式返回）
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// 不拷贝，直接返回底层的字节数组。调用方绝对不能修改返回的切片，否则会修改缓存中的值，
+// 只用于只读的场景（如直接写入 HTTP 响应）以避免大值的拷贝，其他情况使用 ByteSlice
+func (v ByteView) Bytes() []byte {
+	return v.b
+}
+
 // 返回 string 类型的数据
 func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// 长度和容量都为 0 的共享切片，调用方无法通过它修改任何数据，append 也会重新分配
+var emptyBytes = []byte{}
+
 func cloneBytes(b []byte) []byte {
+	// 空值不需要分配内存
+	if len(b) == 0 {
+		return emptyBytes[:0:0]
+	}
 	c := make([]byte, len(b))
 	copy(c, b)
 	return c
@@ -0,0 +1,60 @@
+package cache
+
+import "testing"
+
+func TestByteSliceImmutable(t *testing.T) {
+	v := ByteView{b: []byte("630")}
+	b := v.ByteSlice()
+	b[0] = '9'
+	if v.String() != "630" {
+		t.Fatalf("expect 630, but %s got", v.String())
+	}
+
+	empty := ByteView{}.ByteSlice()
+	if empty == nil || len(empty) != 0 || cap(empty) != 0 {
+		t.Fatal("expect non-nil empty slice with zero capacity")
+	}
+	empty = append(empty, 'x')
+	if again := (ByteView{}).ByteSlice(); len(again) != 0 {
+		t.Fatal("shared empty slice was mutated")
+	}
+}
+
+func BenchmarkByteSliceEmpty(b *testing.B) {
+	v := ByteView{b: []byte{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.ByteSlice()
+	}
+}
+
+func BenchmarkByteSliceSmall(b *testing.B) {
+	v := ByteView{b: []byte("630")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.ByteSlice()
+	}
+}
+
+func TestBytesShares(t *testing.T) {
+	v := ByteView{b: []byte("630")}
+	if b := v.Bytes(); &b[0] != &v.b[0] {
+		t.Fatal("expect Bytes to return the underlying slice")
+	}
+}
+
+var largeView = ByteView{b: make([]byte, 1<<20)}
+
+func BenchmarkByteSliceLarge(b *testing.B) {
+	b.SetBytes(int64(largeView.Len()))
+	for i := 0; i < b.N; i++ {
+		_ = largeView.ByteSlice()
+	}
+}
+
+func BenchmarkBytesLarge(b *testing.B) {
+	b.SetBytes(int64(largeView.Len()))
+	for i := 0; i < b.N; i++ {
+		_ = largeView.Bytes()
+	}
+}
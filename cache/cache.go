@@ -1,37 +1,500 @@
 package cache
 
 import (
+	"cache/consistenthash"
 	"cache/lru"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// Policy 是缓存淘汰算法，lru.Cache、twoqueue.Cache 等都实现了该接口。
+// 实现不需要是并发安全的，cache 会在调用时加锁
+type Policy interface {
+	Add(key string, value lru.Value)
+	Get(key string) (value lru.Value, ok bool)
+	Remove(key string)
+	Len() int
+	Bytes() int64
+	Range(f func(key string, value lru.Value) bool)
+}
+
+// NewPolicy 根据最大内存和淘汰回调创建淘汰算法
+type NewPolicy func(maxBytes int64, onEvicted func(key string, value lru.Value)) Policy
+
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	lru        Policy
 	cacheBytes int64
+	// 创建淘汰算法，为 nil 时使用 LRU
+	newPolicy NewPolicy
+	// 记录被淘汰时的回调，在释放锁之后调用。值被替换和清空缓存时不调用
+	onEvicted func(key string)
+	// 记录离开缓存时的回调，同时给出原因，在释放锁之后调用
+	onEvictedReason func(key string, reason lru.Reason)
+	// 本次操作期间离开缓存的记录，受 mu 保护
+	evicted []evictedKey
+	// 自定义淘汰算法回调时使用的原因，受 mu 保护
+	reason lru.Reason
+	// 不为 nil 时淘汰回调按批次发送到后台 goroutine 依次调用，不占用写入方的时间，见 startAsyncNotify
+	async chan []evictedKey
+	// 关闭后后台 goroutine 退出，之后的回调被丢弃
+	asyncDone chan struct{}
+	// 后台 goroutine 退出后关闭
+	asyncExited chan struct{}
+	// 最近一次添加分配的版本号，受 mu 保护
+	version uint64
+	// get 遇到过期的记录时是否保留，供 getStale 使用，直到被淘汰或替换
+	keepExpired bool
+	// 记录添加到缓存超过该时间后视为过期，不论记录自身的过期时间，0 表示不限制
+	maxAge time.Duration
+	// 不为 nil 时记录按 ring 分到各个分片，每个分片有独立的锁和淘汰算法，见 split
+	shards []*cache
+	// 分片的一致性哈希环，创建后不再修改，可以并发读取
+	ring *consistenthash.Map
+	// 记录的标签索引，记录离开缓存（包括被替换）时在 mu 下更新，为 nil 表示不支持标签。分片共用同一个索引
+	tags *lazyTags
+}
+
+// 每个分片在环上的虚拟节点数
+const shardReplicas = 50
+
+// 把缓存分成 n 个分片，按与节点路由相同的一致性哈希把 key 分到分片，每个分片平分 cacheBytes。
+// hash 为 nil 时使用 crc32。分片复制当前的配置，必须在使用缓存之前调用。n <= 1 时不分片
+func (c *cache) split(n int, hash consistenthash.Hash) {
+	if n <= 1 {
+		return
+	}
+	c.ring = consistenthash.New(shardReplicas, hash)
+	c.shards = make([]*cache, n)
+	names := make([]string, n)
+	for i := range c.shards {
+		c.shards[i] = &cache{
+			cacheBytes:      c.cacheBytes / int64(n),
+			newPolicy:       c.newPolicy,
+			onEvicted:       c.onEvicted,
+			onEvictedReason: c.onEvictedReason,
+			keepExpired:     c.keepExpired,
+			maxAge:          c.maxAge,
+			tags:            c.tags,
+		}
+		names[i] = strconv.Itoa(i)
+	}
+	// 一次排好序，之后的 Get 只读
+	c.ring.AddBatch(names)
+}
+
+// 返回 key 所在的分片，没有分片时返回自身
+func (c *cache) shard(key string) *cache {
+	if c.shards == nil {
+		return c
+	}
+	i, _ := strconv.Atoi(c.ring.Get(key))
+	return c.shards[i]
+}
+
+// 离开缓存的记录和原因
+type evictedKey struct {
+	key    string
+	reason lru.Reason
+}
+
+// 添加缓存，返回本次添加因容量淘汰的记录数
+func (c *cache) add(key string, value ByteView) int {
+	return c.addWithTags(key, value, nil)
 }
 
-func (c *cache) add(key string, value ByteView) {
+// 与 add 相同，每次添加都会分配新的、单调递增的版本号。记录原有的标签被替换为 tags（需要设置了 c.tags），
+// 第一次带有标签时创建标签索引
+func (c *cache) addWithTags(key string, value ByteView, tags []string) int {
+	c = c.shard(key)
 	c.mu.Lock()
-	// 使用 defer 的特性来解锁
-	defer c.mu.Unlock()
 	// 懒汉式，用到的时候再初始化。提高性能，减少内存要求
 	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+		if c.newPolicy != nil {
+			c.lru = c.newPolicy(c.cacheBytes, c.recordEvicted)
+		} else {
+			// 默认的 LRU 可以报告全部原因，包括值被替换
+			l := lru.New(c.cacheBytes, nil)
+			l.OnEvictedReason = c.recordEvictedReason
+			c.lru = l
+		}
 	}
-	c.lru.Add(key, value)
+	stored := false
+	// 单条记录超过容量时不论使用哪种淘汰算法都放不下，跳过并删除原有的记录，避免淘汰全部记录
+	if c.cacheBytes > 0 && int64(len(key))+int64(value.Len()) > c.cacheBytes {
+		c.removeLocked(key, lru.Capacity)
+	} else {
+		stored = true
+		c.reason = lru.Capacity
+		c.version++
+		value.v = c.version
+		if c.maxAge > 0 {
+			value.t = time.Now()
+		}
+		c.lru.Add(key, value)
+	}
+	evicted := c.takeEvicted()
+	for _, e := range evicted {
+		// 淘汰算法可能在添加时立即淘汰新记录
+		if e.key == key && e.reason != lru.Replaced {
+			stored = false
+		}
+	}
+	// 自定义淘汰算法不报告值被替换，每次添加都先清除原有的标签
+	if idx := c.loadTags(); idx != nil {
+		idx.remove(key)
+	}
+	// 只为确实在缓存中的记录建立索引
+	if stored && c.tags != nil && len(tags) > 0 {
+		c.tags.create().set(key, tags)
+	}
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	n := 0
+	for _, e := range evicted {
+		if e.reason == lru.Capacity {
+			n++
+		}
+	}
+	return n
+}
+
+// 返回记录当前的版本号，记录不存在或已过期时为 0
+func (c *cache) currentVersion(key string) uint64 {
+	c = c.shard(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versionLocked(key)
+}
+
+func (c *cache) versionLocked(key string) uint64 {
+	if c.lru == nil {
+		return 0
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return 0
+	}
+	if c.expired(v.(ByteView), time.Now()) {
+		return 0
+	}
+	return v.(ByteView).v
+}
+
+// 返回记录实际的过期时间：自身的过期时间与添加时间加上 maxAge 中较早的一个，零值表示永不过期
+func (c *cache) deadline(value ByteView) time.Time {
+	if c.maxAge <= 0 {
+		return value.e
+	}
+	if d := value.t.Add(c.maxAge); value.e.IsZero() || d.Before(value.e) {
+		return d
+	}
+	return value.e
+}
+
+// 记录在 now 时是否已经过期
+func (c *cache) expired(value ByteView, now time.Time) bool {
+	d := c.deadline(value)
+	return !d.IsZero() && !now.Before(d)
+}
+
+// 删除指定的缓存，会触发淘汰回调
+func (c *cache) remove(key string) {
+	c = c.shard(key)
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.removeLocked(key, lru.Deleted)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+// 按指定的原因删除缓存，调用时已持有 mu
+func (c *cache) removeLocked(key string, reason lru.Reason) {
+	if l, ok := c.lru.(*lru.Cache); ok {
+		l.RemoveWithReason(key, reason)
+		return
+	}
+	c.reason = reason
+	c.lru.Remove(key)
+}
+
+// 启动调用淘汰回调的后台 goroutine，最多缓冲 buffer 个批次，stopAsyncNotify 时退出
+func (c *cache) startAsyncNotify(buffer int) {
+	c.async = make(chan []evictedKey, buffer)
+	c.asyncDone = make(chan struct{})
+	c.asyncExited = make(chan struct{})
+	// 分片共用同一个后台 goroutine
+	for _, s := range c.shards {
+		s.async, s.asyncDone = c.async, c.asyncDone
+	}
+	go func() {
+		defer close(c.asyncExited)
+		for {
+			select {
+			case evicted := <-c.async:
+				c.runEvicted(evicted)
+			case <-c.asyncDone:
+				// 调用完已经缓冲的批次再退出
+				for {
+					select {
+					case evicted := <-c.async:
+						c.runEvicted(evicted)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// 停止后台 goroutine，等待已经缓冲的批次调用完
+func (c *cache) stopAsyncNotify() {
+	if c.async == nil {
+		return
+	}
+	close(c.asyncDone)
+	<-c.asyncExited
+}
+
+// 取出本次操作期间离开缓存的记录，调用时已持有 mu
+func (c *cache) takeEvicted() []evictedKey {
+	evicted := c.evicted
+	c.evicted = nil
+	// 离开缓存的记录不再带有标签
+	if tags := c.loadTags(); tags != nil {
+		for _, e := range evicted {
+			tags.remove(e.key)
+		}
+	}
+	return evicted
+}
+
+// 返回已经创建的标签索引，不支持标签或还没有使用过标签时返回 nil
+func (c *cache) loadTags() *tagIndex {
+	if c.tags == nil {
+		return nil
+	}
+	return c.tags.load()
 }
 
+// 回调不能在持有锁时执行，避免回调中再次访问缓存导致死锁
+func (c *cache) notifyEvicted(evicted []evictedKey) {
+	if len(evicted) == 0 || (c.onEvicted == nil && c.onEvictedReason == nil) {
+		return
+	}
+	if c.async != nil {
+		// 缓冲区满时阻塞，批次之间保持顺序
+		select {
+		case c.async <- evicted:
+		case <-c.asyncDone:
+		}
+		return
+	}
+	c.runEvicted(evicted)
+}
+
+// 按离开缓存的顺序调用淘汰回调
+func (c *cache) runEvicted(evicted []evictedKey) {
+	for _, e := range evicted {
+		if c.onEvicted != nil && e.reason != lru.Replaced && e.reason != lru.Cleared {
+			c.onEvicted(e.key)
+		}
+		if c.onEvictedReason != nil {
+			c.onEvictedReason(e.key, e.reason)
+		}
+	}
+}
+
+// 自定义淘汰算法的 OnEvicted 回调，原因由当前的操作决定，调用时已持有 mu
+func (c *cache) recordEvicted(key string, value lru.Value) {
+	c.evicted = append(c.evicted, evictedKey{key, c.reason})
+}
+
+// lru.Cache 的 OnEvictedReason 回调，调用时已持有 mu
+func (c *cache) recordEvictedReason(key string, value lru.Value, reason lru.Reason) {
+	c.evicted = append(c.evicted, evictedKey{key, reason})
+}
+
+// 获取缓存，已过期的记录会被删除并视为未命中
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	c = c.shard(key)
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return
+	}
+
+	v, ok := c.lru.Get(key)
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	value = v.(ByteView)
+	if !c.expired(value, time.Now()) {
+		c.mu.Unlock()
+		value.e = c.deadline(value)
+		return value, true
+	}
+	if c.keepExpired {
+		c.mu.Unlock()
+		return ByteView{}, false
+	}
+	c.removeLocked(key, lru.Expired)
+	evicted := c.takeEvicted()
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+	return ByteView{}, false
+}
+
+// 获取已经过期但还没有被删除的记录，记录不存在或没有过期时返回 false
+func (c *cache) getStale(key string) (value ByteView, ok bool) {
+	c = c.shard(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return
+	}
+	value = v.(ByteView)
+	if !c.expired(value, time.Now()) {
+		return ByteView{}, false
+	}
+	return value, true
+}
+
+// 将未过期的记录的过期时间改为 expire，记录不存在或已过期时返回 false。
+// 与 get 一样会更新记录在淘汰算法中的位置
+func (c *cache) touch(key string, expire time.Time) bool {
+	c = c.shard(key)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.lru == nil {
+		return false
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return false
+	}
+	value := v.(ByteView)
+	if c.expired(value, time.Now()) {
+		return false
+	}
+	value.e = expire
+	c.lru.Add(key, value)
+	// 只修改了过期时间，不报告值被替换
+	c.evicted = nil
+	return true
+}
+
+// 清空缓存，只触发带原因的淘汰回调（原因为 Cleared）
+func (c *cache) clear() {
+	for _, s := range c.shards {
+		s.clear()
+	}
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
 		return
 	}
+	var evicted []evictedKey
+	tags := c.loadTags()
+	if c.onEvictedReason != nil || tags != nil {
+		c.lru.Range(func(key string, value lru.Value) bool {
+			evicted = append(evicted, evictedKey{key, lru.Cleared})
+			if tags != nil {
+				tags.remove(key)
+			}
+			return true
+		})
+	}
+	c.lru = nil
+	c.mu.Unlock()
+
+	c.notifyEvicted(evicted)
+}
+
+// 返回全部缓存的 key，从最近使用到最久未使用。分片时只在每个分片内有序
+func (c *cache) keys() []string {
+	if c.shards != nil {
+		var keys []string
+		for _, s := range c.shards {
+			keys = append(keys, s.keys()...)
+		}
+		return keys
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	keys := make([]string, 0, c.lru.Len())
+	c.lru.Range(func(key string, value lru.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
 
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+// 从最近使用到最久未使用返回最多 limit 个未过期的 key，limit <= 0 表示不限制。不改变记录的顺序。
+// 分片时依次取各个分片的 key，只在每个分片内有序
+func (c *cache) recentKeys(limit int) []string {
+	if c.shards != nil {
+		var keys []string
+		for _, s := range c.shards {
+			if limit > 0 && len(keys) >= limit {
+				break
+			}
+			rest := 0
+			if limit > 0 {
+				rest = limit - len(keys)
+			}
+			keys = append(keys, s.recentKeys(rest)...)
+		}
+		return keys
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
 	}
+	var keys []string
+	now := time.Now()
+	c.lru.Range(func(key string, value lru.Value) bool {
+		if c.expired(value.(ByteView), now) {
+			return true
+		}
+		keys = append(keys, key)
+		return limit <= 0 || len(keys) < limit
+	})
+	return keys
+}
 
-	return
+// 返回字节数和记录数，两者在同一把锁下读取，淘汰过程中也是一致的
+func (c *cache) size() (bytes int64, entries int) {
+	if c.shards != nil {
+		for _, s := range c.shards {
+			b, n := s.size()
+			bytes += b
+			entries += n
+		}
+		return bytes, entries
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return 0, 0
+	}
+	return c.lru.Bytes(), c.lru.Len()
 }
@@ -0,0 +1,133 @@
+package clock
+
+import "cache/lru"
+
+// Clock（二次机会）缓存：记录存放在环形数组中，Get 只设置访问位，不移动记录。
+// 淘汰时指针顺时针扫描，访问位为 1 的记录清零后跳过（第二次机会），
+// 访问位为 0 的记录被淘汰。是 LRU 的近似，当前非线程安全
+type Cache struct {
+	maxBytes int64
+	nbytes   int64
+	// 环形数组，被删除的位置为 nil
+	slots []*entry
+	// 空闲位置的下标
+	free []int
+	// 扫描指针
+	hand int
+	// key 到 slots 下标的映射
+	cache map[string]int
+	// 可选的方法（回调作用）
+	OnEvicted func(key string, value lru.Value)
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+	// 访问位
+	ref bool
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]int),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 添加值到缓存中
+func (c *Cache) Add(key string, value lru.Value) {
+	if idx, ok := c.cache[key]; ok {
+		kv := c.slots[idx]
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.ref = true
+	} else {
+		kv := &entry{key: key, value: value}
+		if n := len(c.free); n > 0 {
+			idx = c.free[n-1]
+			c.free = c.free[:n-1]
+			c.slots[idx] = kv
+		} else {
+			idx = len(c.slots)
+			c.slots = append(c.slots, kv)
+		}
+		c.cache[key] = idx
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// 从缓存中获取值，只设置访问位
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if idx, ok := c.cache[key]; ok {
+		kv := c.slots[idx]
+		kv.ref = true
+		return kv.value, true
+	}
+	return
+}
+
+// 移动指针淘汰一条记录：清除沿途记录的访问位，淘汰第一个访问位为 0 的记录
+func (c *Cache) RemoveOldest() {
+	if len(c.cache) == 0 {
+		return
+	}
+	for {
+		if c.hand >= len(c.slots) {
+			c.hand = 0
+		}
+		kv := c.slots[c.hand]
+		if kv != nil {
+			if !kv.ref {
+				c.removeAt(c.hand)
+				c.hand++
+				return
+			}
+			kv.ref = false
+		}
+		c.hand++
+	}
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if idx, ok := c.cache[key]; ok {
+		c.removeAt(idx)
+	}
+}
+
+// 按环形数组的顺序从指针处开始遍历记录（不是访问顺序），f 返回 false 时停止。
+// 调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value lru.Value) bool) {
+	for i := 0; i < len(c.slots); i++ {
+		if kv := c.slots[(c.hand+i)%len(c.slots)]; kv != nil {
+			if !f(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// 缓存中的记录数
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+func (c *Cache) removeAt(idx int) {
+	kv := c.slots[idx]
+	c.slots[idx] = nil
+	c.free = append(c.free, idx)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 缓存中记录（key 和 value）占用的总字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,68 @@
+package clock
+
+import (
+	"cache/lru"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestSecondChance(t *testing.T) {
+	keys := make([]string, 0)
+	c := New(int64(len("k1v1k2v2k3v3")), func(key string, value lru.Value) {
+		keys = append(keys, key)
+	})
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	// k1 被访问过，获得第二次机会，k2 被淘汰
+	c.Get("k1")
+	c.Add("k4", String("v4"))
+
+	if !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("expect k2 evicted, but %v got", keys)
+	}
+	if _, ok := c.Get("k1"); !ok || c.Len() != 3 || c.nbytes != int64(len("k1v1k3v3k4v4")) {
+		t.Fatal("expect k1 to survive")
+	}
+
+	c.Remove("k3")
+	if _, ok := c.Get("k3"); ok || c.Len() != 2 {
+		t.Fatal("remove k3 failed")
+	}
+}
+
+func benchmarkGet(b *testing.B, c interface {
+	Add(string, lru.Value)
+	Get(string) (lru.Value, bool)
+}) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		c.Add(keys[i], String("v"))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Get(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkClockGet(b *testing.B) { benchmarkGet(b, New(0, nil)) }
+func BenchmarkLRUGet(b *testing.B)   { benchmarkGet(b, lru.New(0, nil)) }
@@ -0,0 +1,357 @@
+package cache
+
+import (
+	pb "cache/geecachepb"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec 是节点之间通信的编码格式，ServeHTTP 根据请求的 Accept 头选择，
+// httpGetter 根据响应的 Content-Type 头解码
+type Codec interface {
+	// 编码格式对应的 Content-Type
+	ContentType() string
+	Marshal(res *pb.Response) ([]byte, error)
+	Unmarshal(data []byte, res *pb.Response) error
+}
+
+var (
+	// ProtobufCodec 使用 protobuf 编码，是默认的编码格式
+	ProtobufCodec Codec = protobufCodec{}
+	// JSONCodec 使用 JSON 编码，value 为 base64 字符串
+	JSONCodec Codec = jsonCodec{}
+	// MsgpackCodec 使用 msgpack 编码，格式为 {"value": bin}，节点没有该 key 时为 {"value": bin, "not_found": true}。
+	// 解码时字段的顺序不限，value 也可以是 str，未知的字段被忽略
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+// 内置的编码格式，按 Content-Type 查找
+var builtinCodecs = []Codec{ProtobufCodec, JSONCodec, MsgpackCodec}
+
+// 根据 Content-Type 查找编码格式，旧版本节点返回的 application/octet-stream 视为 protobuf。
+// codecs 为 nil 时使用内置的编码格式
+func codecByContentType(contentType string, codecs []Codec) (Codec, bool) {
+	if codecs == nil {
+		codecs = builtinCodecs
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if mediaType == "application/octet-stream" {
+		return ProtobufCodec, true
+	}
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Accept 头中是否明确列出了 contentType 的媒体类型，不匹配 */* 等通配符。contentType 为空时返回 false
+func acceptsMediaType(accept, contentType string) bool {
+	want, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(accept, ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == want {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据 Accept 头选择第一个支持的编码格式，没有匹配时返回 false
+func negotiateCodec(accept string, codecs []Codec) (Codec, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		if c, ok := codecByContentType(strings.TrimSpace(part), codecs); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(res *pb.Response) ([]byte, error) {
+	return proto.Marshal(res)
+}
+
+func (protobufCodec) Unmarshal(data []byte, res *pb.Response) error {
+	return proto.Unmarshal(data, res)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(res *pb.Response) ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (jsonCodec) Unmarshal(data []byte, res *pb.Response) error {
+	return json.Unmarshal(data, res)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+// msgpack 中 map 的字段名
+const (
+	msgpackValueKey       = "value"
+	msgpackNotFoundKey    = "not_found"
+	msgpackContentTypeKey = "content_type"
+)
+
+func (msgpackCodec) Marshal(res *pb.Response) ([]byte, error) {
+	v, ct := res.GetValue(), res.GetContentType()
+	buf := make([]byte, 0, len(v)+len(ct)+len(msgpackValueKey)+len(msgpackNotFoundKey)+len(msgpackContentTypeKey)+24)
+	// fixmap，value 之后的 not_found 和 content_type 只在不是零值时写入
+	fields := byte(1)
+	if res.GetNotFound() {
+		fields++
+	}
+	if ct != "" {
+		fields++
+	}
+	buf = append(buf, 0x80|fields)
+	buf = appendMsgpackStr(buf, msgpackValueKey)
+	buf = appendMsgpackLen(buf, 0xc4, 0xc5, 0xc6, len(v))
+	buf = append(buf, v...)
+	if res.GetNotFound() {
+		buf = appendMsgpackStr(buf, msgpackNotFoundKey)
+		// true
+		buf = append(buf, 0xc3)
+	}
+	if ct != "" {
+		buf = appendMsgpackStr(buf, msgpackContentTypeKey)
+		buf = appendMsgpackStr(buf, ct)
+	}
+	return buf, nil
+}
+
+// 写入字符串：fixstr、str8、str16 或 str32
+func appendMsgpackStr(buf []byte, s string) []byte {
+	if len(s) < 32 {
+		buf = append(buf, 0xa0|byte(len(s)))
+	} else {
+		buf = appendMsgpackLen(buf, 0xd9, 0xda, 0xdb, len(s))
+	}
+	return append(buf, s...)
+}
+
+// 按长度选择 8、16、32 位的类型并写入类型和长度
+func appendMsgpackLen(buf []byte, t8, t16, t32 byte, n int) []byte {
+	switch {
+	case n <= 0xff:
+		return append(buf, t8, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, t16, 0, 0)
+		binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(n))
+	default:
+		buf = append(buf, t32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(n))
+	}
+	return buf
+}
+
+// 读取 data[0] 之后 size 字节的大端长度，返回长度和剩余的数据。长度超过剩余的数据时返回错误
+func readMsgpackLen(data []byte, size int) (int, []byte, error) {
+	if len(data) < 1+size {
+		return 0, nil, errMsgpack
+	}
+	var n uint64
+	for _, b := range data[1 : 1+size] {
+		n = n<<8 | uint64(b)
+	}
+	data = data[1+size:]
+	if n > uint64(len(data)) {
+		return 0, nil, errMsgpack
+	}
+	return int(n), data, nil
+}
+
+// 读取 str 或 bin（各种长度），返回内容和剩余的数据。
+// 不区分两者：旧规范的编码器（如 use_bin_type=False 的 Python msgpack）把字节串写成 str
+func readMsgpackRaw(data []byte) ([]byte, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errMsgpack
+	}
+	var (
+		n   int
+		err error
+	)
+	switch b := data[0]; {
+	case b&0xe0 == 0xa0:
+		n, data = int(b&0x1f), data[1:]
+	case b == 0xc4 || b == 0xd9:
+		n, data, err = readMsgpackLen(data, 1)
+	case b == 0xc5 || b == 0xda:
+		n, data, err = readMsgpackLen(data, 2)
+	case b == 0xc6 || b == 0xdb:
+		n, data, err = readMsgpackLen(data, 4)
+	default:
+		return nil, nil, errMsgpack
+	}
+	if err != nil || len(data) < n {
+		return nil, nil, errMsgpack
+	}
+	return data[:n], data[n:], nil
+}
+
+// 读取 str 或 bin，返回字符串和剩余的数据
+func readMsgpackStr(data []byte) (string, []byte, error) {
+	b, data, err := readMsgpackRaw(data)
+	return string(b), data, err
+}
+
+// 读取 map 或 array 的头部，返回元素个数和剩余的数据。fix 为 fixmap/fixarray 的前缀，t16、t32 为 16、32 位的类型
+func readMsgpackCount(data []byte, fix, t16, t32 byte) (int, []byte, error) {
+	switch {
+	case len(data) == 0:
+		return 0, nil, errMsgpack
+	case data[0]&0xf0 == fix:
+		return int(data[0] & 0x0f), data[1:], nil
+	case data[0] == t16:
+		return readMsgpackLen(data, 2)
+	case data[0] == t32:
+		return readMsgpackLen(data, 4)
+	}
+	return 0, nil, errMsgpack
+}
+
+// 嵌套的 map 和 array 的最大深度，避免恶意的数据耗尽栈
+const msgpackMaxDepth = 32
+
+// 跳过一个任意类型的值，返回剩余的数据，用于忽略未知的字段
+func skipMsgpack(data []byte, depth int) ([]byte, error) {
+	if len(data) == 0 || depth > msgpackMaxDepth {
+		return nil, errMsgpack
+	}
+	// 定长类型的总字节数，包括类型
+	size := 0
+	switch b := data[0]; {
+	case b <= 0x7f || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+		size = 1
+	case b == 0xcc || b == 0xd0:
+		size = 2
+	case b == 0xcd || b == 0xd1 || b == 0xd4:
+		size = 3
+	case b == 0xd5:
+		size = 4
+	case b == 0xca || b == 0xce || b == 0xd2:
+		size = 5
+	case b == 0xd6:
+		size = 6
+	case b == 0xcb || b == 0xcf || b == 0xd3:
+		size = 9
+	case b == 0xd7:
+		size = 10
+	case b == 0xd8:
+		size = 18
+	case b >= 0xc7 && b <= 0xc9:
+		// ext8/16/32：长度之后还有 1 字节的类型
+		n, rest, err := readMsgpackLen(data, 1<<(b-0xc7))
+		if err != nil || len(rest) < n+1 {
+			return nil, errMsgpack
+		}
+		return rest[n+1:], nil
+	case b&0xf0 == 0x80 || b == 0xde || b == 0xdf:
+		n, rest, err := readMsgpackCount(data, 0x80, 0xde, 0xdf)
+		if err != nil {
+			return nil, err
+		}
+		return skipMsgpackN(rest, 2*n, depth)
+	case b&0xf0 == 0x90 || b == 0xdc || b == 0xdd:
+		n, rest, err := readMsgpackCount(data, 0x90, 0xdc, 0xdd)
+		if err != nil {
+			return nil, err
+		}
+		return skipMsgpackN(rest, n, depth)
+	default:
+		_, rest, err := readMsgpackRaw(data)
+		return rest, err
+	}
+	if len(data) < size {
+		return nil, errMsgpack
+	}
+	return data[size:], nil
+}
+
+// 依次跳过 n 个值
+func skipMsgpackN(data []byte, n int, depth int) ([]byte, error) {
+	var err error
+	for i := 0; i < n; i++ {
+		if data, err = skipMsgpack(data, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+var errMsgpack = errors.New("msgpack: unexpected format")
+
+// 字段的顺序不限，未知的字段被忽略，缺少的字段和值为 nil 的字段为零值。value 可以是 bin 或 str
+func (msgpackCodec) Unmarshal(data []byte, res *pb.Response) error {
+	fields, data, err := readMsgpackCount(data, 0x80, 0xde, 0xdf)
+	if err != nil {
+		return err
+	}
+	res.Value = nil
+	res.NotFound = false
+	res.ContentType = ""
+	for i := 0; i < fields; i++ {
+		var key string
+		if key, data, err = readMsgpackStr(data); err != nil {
+			return err
+		}
+		// nil 视为零值
+		if len(data) > 0 && data[0] == 0xc0 {
+			data = data[1:]
+			continue
+		}
+		switch key {
+		case msgpackValueKey:
+			var v []byte
+			if v, data, err = readMsgpackRaw(data); err != nil {
+				return err
+			}
+			res.Value = append([]byte(nil), v...)
+		case msgpackNotFoundKey:
+			if len(data) == 0 {
+				return errMsgpack
+			}
+			switch data[0] {
+			case 0xc2:
+				res.NotFound = false
+			case 0xc3:
+				res.NotFound = true
+			default:
+				return errMsgpack
+			}
+			data = data[1:]
+		case msgpackContentTypeKey:
+			if res.ContentType, data, err = readMsgpackStr(data); err != nil {
+				return err
+			}
+		default:
+			if data, err = skipMsgpack(data, 0); err != nil {
+				return err
+			}
+		}
+	}
+	if len(data) != 0 {
+		return errMsgpack
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	pb "cache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	values := [][]byte{{}, []byte("630"), bytes.Repeat([]byte("x"), 300), bytes.Repeat([]byte("y"), 70000)}
+	for _, c := range builtinCodecs {
+		for _, v := range values {
+			data, err := c.Marshal(&pb.Response{Value: v})
+			if err != nil {
+				t.Fatalf("%s: %v", c.ContentType(), err)
+			}
+			res := &pb.Response{}
+			if err := c.Unmarshal(data, res); err != nil || !bytes.Equal(res.Value, v) || res.NotFound {
+				t.Fatalf("%s: round trip of %d bytes failed: %v", c.ContentType(), len(v), err)
+			}
+		}
+		data, err := c.Marshal(&pb.Response{NotFound: true})
+		if err != nil {
+			t.Fatalf("%s: %v", c.ContentType(), err)
+		}
+		res := &pb.Response{}
+		if err := c.Unmarshal(data, res); err != nil || !res.NotFound || res.ContentType != "" {
+			t.Fatalf("%s: round trip of not_found failed: %v", c.ContentType(), err)
+		}
+		// 超过 255 字节的 Content-Type 同样可以编码
+		for _, n := range []int{40, 300} {
+			ct := "application/vnd.example+json; charset=utf-8; profile=" + strings.Repeat("x", n)
+			data, err = c.Marshal(&pb.Response{Value: []byte("{}"), ContentType: ct})
+			if err != nil {
+				t.Fatalf("%s: %v", c.ContentType(), err)
+			}
+			res = &pb.Response{}
+			if err := c.Unmarshal(data, res); err != nil || string(res.Value) != "{}" || res.ContentType != ct || res.NotFound {
+				t.Fatalf("%s: round trip of content_type failed: %q, %v", c.ContentType(), res.ContentType, err)
+			}
+		}
+	}
+}
+
+func TestMsgpackUnmarshalInterop(t *testing.T) {
+	str := func(s string) []byte {
+		return append([]byte{0xa0 | byte(len(s))}, s...)
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	long := strings.Repeat("v", 300)
+	for name, data := range map[string][]byte{
+		// 其他语言的编码器不一定按 value 在前的顺序写入，并且可能带有其他字段
+		"any order": join([]byte{0x84},
+			str("content_type"), str("text/plain"),
+			str("not_found"), []byte{0xc2},
+			str("extra"), []byte{0x92, 0x01, 0x81}, str("a"), []byte{0xcb, 0, 0, 0, 0, 0, 0, 0, 0},
+			str("value"), []byte{0xc4, 0x03}, []byte("630")),
+		// use_bin_type=False 时字节串写成 str，map16 头部
+		"str value": join([]byte{0xde, 0x00, 0x02},
+			str("content_type"), str("text/plain"),
+			str("value"), []byte{0xd9, 0x03}, []byte("630")),
+		"nil fields": join([]byte{0x83},
+			str("not_found"), []byte{0xc0},
+			str("content_type"), []byte{0xc0},
+			str("value"), []byte{0xa3}, []byte("630")),
+	} {
+		res := &pb.Response{}
+		if err := MsgpackCodec.Unmarshal(data, res); err != nil || string(res.Value) != "630" || res.NotFound {
+			t.Fatalf("%s: expect 630, but %q, %v got", name, res.Value, err)
+		}
+		if name != "nil fields" && res.ContentType != "text/plain" {
+			t.Fatalf("%s: expect text/plain, but %q got", name, res.ContentType)
+		}
+	}
+
+	// str16 和 bin32 的值
+	for _, data := range [][]byte{
+		join([]byte{0x81}, str("value"), []byte{0xda, 0x01, 0x2c}, []byte(long)),
+		join([]byte{0x81}, str("value"), []byte{0xc6, 0x00, 0x00, 0x01, 0x2c}, []byte(long)),
+	} {
+		res := &pb.Response{}
+		if err := MsgpackCodec.Unmarshal(data, res); err != nil || string(res.Value) != long {
+			t.Fatalf("expect %d bytes, but %d, %v got", len(long), len(res.Value), err)
+		}
+	}
+
+	// 截断的数据返回错误
+	data, _ := MsgpackCodec.Marshal(&pb.Response{Value: []byte(long), ContentType: "text/plain"})
+	for i := 0; i < len(data); i++ {
+		if err := MsgpackCodec.Unmarshal(data[:i], &pb.Response{}); err == nil {
+			t.Fatalf("expect error for %d of %d bytes", i, len(data))
+		}
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	NewGroup("codec", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value of " + key), nil
+		}))
+	defer RemoveGroup("codec")
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})))
+	defer srv.Close()
+
+	for _, c := range builtinCodecs {
+		p := NewHTTPPool("http://localhost:8002", WithCodec(c))
+		p.Set(srv.URL)
+		peer, ok := p.PickPeer("Tom")
+		if !ok {
+			t.Fatal("expect remote peer picked")
+		}
+		res := &pb.Response{}
+		if err := peer.Get(&pb.Request{Group: "codec", Key: "Tom"}, res); err != nil || string(res.Value) != "value of Tom" {
+			t.Fatalf("%s: expect value of Tom, but %s, %v got", c.ContentType(), res.Value, err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"codec/Tom", nil)
+		req.Header.Set("Accept", c.ContentType())
+		w := httptest.NewRecorder()
+		NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})).ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); ct != c.ContentType() {
+			t.Fatalf("expect Content-Type %s, but %s got", c.ContentType(), ct)
+		}
+	}
+}
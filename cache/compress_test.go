@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var fragment = []byte(strings.Repeat("<div class=\"item\"><span>hello</span></div>\n", 200))
+
+func TestGzipCompressor(t *testing.T) {
+	var c Compressor = GzipCompressor{}
+	compressed, err := c.Compress(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(fragment) {
+		t.Fatalf("expect compressed size < %d, but %d got", len(fragment), len(compressed))
+	}
+	raw, err := c.Decompress(compressed)
+	if err != nil || !bytes.Equal(raw, fragment) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
+
+func TestGroupCompression(t *testing.T) {
+	gee := NewGroup("compress", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return fragment, nil
+		}), WithCompressor(GzipCompressor{}))
+
+	// 原始值大于缓存容量，压缩之后可以放入缓存
+	for i := 0; i < 2; i++ {
+		view, err := gee.Get("page")
+		if err != nil || !bytes.Equal(view.ByteSlice(), fragment) {
+			t.Fatalf("get compressed value failed: %v", err)
+		}
+	}
+	if v, ok := gee.mainCache.get("page"); !ok || v.Len() >= len(fragment) {
+		t.Fatal("expect value stored compressed")
+	}
+}
+
+func BenchmarkGzipCompress(b *testing.B) {
+	c := GzipCompressor{}
+	b.SetBytes(int64(len(fragment)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Compress(fragment)
+	}
+}
+
+func BenchmarkGzipDecompress(b *testing.B) {
+	c := GzipCompressor{}
+	compressed, _ := c.Compress(fragment)
+	b.ReportMetric(float64(len(fragment))/float64(len(compressed)), "ratio")
+	b.SetBytes(int64(len(fragment)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Decompress(compressed)
+	}
+}
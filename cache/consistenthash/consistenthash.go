@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -19,14 +20,29 @@ type Map struct {
 	keys []int
 	// 虚拟节点与真实节点的映射表。键是虚拟节点的哈希值，值是真实节点的名称
 	hashMap map[int]string
+	// keys 是否需要重新排序，Add 只追加不排序，推迟到下一次 Get 或 Remove
+	dirty bool
+	// 混入虚拟节点哈希输入的种子，相同的节点使用不同的种子得到不同的环
+	seed string
+	// 哈希冲突时落选的真实节点，按哈希值记录。环上保留字典序最小的节点，
+	// 它被移除后由落选的节点接替，使路由结果与添加顺序无关
+	shadowed map[int][]string
 }
 
 // 实例化 Map，允许自定义哈希函数和虚拟节点倍数
 func New(replicas int, fn Hash) *Map {
+	return NewWithSeed(replicas, fn, "")
+}
+
+// 与 New 相同，seed 会混入每个虚拟节点的哈希输入，使相同的节点在不同的 Map 中
+// 得到不同的分配（如 A/B 路由）。seed 为空时与 New 相同
+func NewWithSeed(replicas int, fn Hash, seed string) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		seed:     seed,
+		shadowed: make(map[int][]string),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -34,41 +50,239 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// 添加节点到容器中
+// 添加节点到容器中。只追加虚拟节点，排序推迟到下一次 Get 或 Remove，
+// 逐个添加大量节点时不会每次都排序
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
 		// 添加虚拟节点
 		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+			hash := int(m.hash([]byte(m.virtualNode(i, key))))
+			owner, ok := m.hashMap[hash]
+			switch {
+			case !ok:
+				m.keys = append(m.keys, hash)
+				m.hashMap[hash] = key
+			case owner != key:
+				// 哈希冲突，保留字典序较小的节点
+				loser := key
+				if key < owner {
+					m.hashMap[hash] = key
+					loser = owner
+				}
+				m.shadowed[hash] = appendUnique(m.shadowed[hash], loser)
+			}
 		}
 	}
-	// 对环上的哈希值排序
-	sort.Ints(m.keys)
+	m.dirty = true
+}
+
+// 批量添加节点并立即排序一次，之后的 Get 不需要再排序
+func (m *Map) AddBatch(keys []string) {
+	m.Add(keys...)
+	m.sortKeys()
+}
+
+// 对环上的哈希值排序
+func (m *Map) sortKeys() {
+	if m.dirty {
+		sort.Ints(m.keys)
+		m.dirty = false
+	}
 }
 
-// 从容器中获取出离 key 最近的节点
+// 从容器中获取出离 key 最近的节点。可能会对哈希环排序，与其他方法一样不是并发安全的
 func (m *Map) Get(key string) string {
+	node, _ := m.GetWithHash(key)
+	return node
+}
+
+// 与 Get 相同，同时返回 key 的哈希值（即 key 在环上的位置），用于排查分布不均。
+// 环为空时 node 为空字符串
+func (m *Map) GetWithHash(key string) (node string, hash uint32) {
+	hash = m.hash([]byte(key))
 	if len(m.keys) == 0 {
-		return ""
+		return "", hash
 	}
+	m.sortKeys()
 
-	hash := int(m.hash([]byte(key)))
 	// 二叉搜索节点
 	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
+		return m.keys[i] >= int(hash)
 	})
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return m.hashMap[m.keys[idx%len(m.keys)]], hash
+}
+
+// 从 key 所在位置开始顺时针返回最多 n 个不同的真实节点，第一个与 Get 的结果相同。
+// 首选节点不可用时可以依次尝试后面的节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	m.sortKeys()
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
 }
 
-// 从哈希表和哈希环中移除节点
+// 从哈希表和哈希环中移除节点，只删除确实属于该节点的虚拟节点
 func (m *Map) Remove(key string) {
+	m.sortKeys()
 	for i := 0; i < m.replicas; i++ {
-		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		hash := int(m.hash([]byte(m.virtualNode(i, key))))
+		owner, ok := m.hashMap[hash]
+		if !ok {
+			continue
+		}
+		if owner != key {
+			if losers := removeString(m.shadowed[hash], key); len(losers) > 0 {
+				m.shadowed[hash] = losers
+			} else {
+				delete(m.shadowed, hash)
+			}
+			continue
+		}
+		// 由冲突时落选的字典序最小的节点接替
+		if losers := m.shadowed[hash]; len(losers) > 0 {
+			next := minString(losers)
+			m.hashMap[hash] = next
+			if losers = removeString(losers, next); len(losers) > 0 {
+				m.shadowed[hash] = losers
+			} else {
+				delete(m.shadowed, hash)
+			}
+			continue
+		}
 		idx := sort.SearchInts(m.keys, hash)
-		m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+		if idx < len(m.keys) && m.keys[idx] == hash {
+			m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+		}
 		delete(m.hashMap, hash)
 	}
 }
+
+func appendUnique(nodes []string, node string) []string {
+	for _, n := range nodes {
+		if n == node {
+			return nodes
+		}
+	}
+	return append(nodes, node)
+}
+
+// 返回字典序最小的节点，nodes 为空时返回空字符串
+func minString(nodes []string) string {
+	min := ""
+	for i, node := range nodes {
+		if i == 0 || node < min {
+			min = node
+		}
+	}
+	return min
+}
+
+func removeString(nodes []string, node string) []string {
+	for i, n := range nodes {
+		if n == node {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+// 环上的一段哈希区间 (From, To]，From >= To 时跨过环的起点（From == To 时为整个环）。
+// Owner 是区间内的 key 所属的真实节点
+type Range struct {
+	From, To uint32
+	Owner    string
+}
+
+// 判断哈希值是否落在区间内
+func (r Range) Contains(hash uint32) bool {
+	if r.From < r.To {
+		return hash > r.From && hash <= r.To
+	}
+	return hash > r.From || hash <= r.To
+}
+
+// 预览移除节点的影响，不修改环：返回该节点的虚拟节点负责的哈希区间，Owner 为移除之后
+// 接管区间的节点（移除后环为空时为空字符串）。用于移除节点之前预热新的所属节点
+func (m *Map) RemovePreview(key string) []Range {
+	m.sortKeys()
+	var ranges []Range
+	for idx, hash := range m.keys {
+		if m.hashMap[hash] != key {
+			continue
+		}
+		prev := m.keys[(idx+len(m.keys)-1)%len(m.keys)]
+		r := Range{From: uint32(prev), To: uint32(hash)}
+		// 由顺时针方向（包括该位置本身）第一个移除之后仍然存在的虚拟节点接管区间，
+		// 冲突时落选的节点会原地接替
+		for i := 0; i < len(m.keys); i++ {
+			h := m.keys[(idx+i)%len(m.keys)]
+			node := m.hashMap[h]
+			if node == key {
+				node = minString(m.shadowed[h])
+			}
+			if node != "" {
+				r.Owner = node
+				break
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// 返回节点的第 i 个虚拟节点的哈希输入
+func (m *Map) virtualNode(i int, key string) string {
+	return m.seed + strconv.Itoa(i) + key
+}
+
+// 返回虚拟节点倍数
+func (m *Map) Replicas() int {
+	return m.replicas
+}
+
+// 统计每个真实节点在环上的虚拟节点数，哈希冲突时被覆盖的虚拟节点不计入
+func (m *Map) Distribution() map[string]int {
+	dist := make(map[string]int)
+	for _, node := range m.hashMap {
+		dist[node]++
+	}
+	return dist
+}
+
+// 用一组样本 key 估计负载均衡程度：返回各真实节点分到的 key 数，
+// 以及分到的 key 数的标准差相对平均值的比例（越小越均衡）
+func (m *Map) Balance(sample []string) (counts map[string]int, relStdDev float64) {
+	counts = make(map[string]int)
+	for _, node := range m.hashMap {
+		counts[node] = 0
+	}
+	if len(counts) == 0 || len(sample) == 0 {
+		return counts, 0
+	}
+	for _, key := range sample {
+		counts[m.Get(key)]++
+	}
+	mean := float64(len(sample)) / float64(len(counts))
+	var variance float64
+	for _, n := range counts {
+		variance += (float64(n) - mean) * (float64(n) - mean)
+	}
+	variance /= float64(len(counts))
+	return counts, math.Sqrt(variance) / mean
+}
@@ -3,6 +3,8 @@ package consistenthash
 import (
 	"fmt"
 	"hash/crc32"
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
 )
@@ -53,3 +55,245 @@ func Test1(t *testing.T) {
 	fmt.Println(int(crc32.ChecksumIEEE([]byte("9mynode"))))
 	fmt.Println(int(crc32.ChecksumIEEE([]byte("10mynode"))))
 }
+
+func TestDistribution(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("node1", "node2", "node3")
+	if hash.Replicas() != 50 {
+		t.Fatalf("expect 50 replicas, but %d got", hash.Replicas())
+	}
+	dist := hash.Distribution()
+	if len(dist) != 3 {
+		t.Fatalf("expect 3 nodes, but %v got", dist)
+	}
+	for node, n := range dist {
+		if n != 50 {
+			t.Errorf("expect 50 virtual nodes for %s, but %d got", node, n)
+		}
+	}
+
+	sample := make([]string, 10000)
+	for i := range sample {
+		sample[i] = "key" + strconv.Itoa(i)
+	}
+	counts, dev := hash.Balance(sample)
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if len(counts) != 3 || total != len(sample) || dev <= 0 || dev >= 1 {
+		t.Fatalf("unexpected balance report %v, %f", counts, dev)
+	}
+}
+
+func TestDeferredSort(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 逐个添加，排序推迟到 Get
+	hash.Add("6")
+	hash.Add("4")
+	hash.Add("2")
+	if hash.Get("11") != "2" || hash.Get("23") != "4" || hash.Get("27") != "2" {
+		t.Fatal("expect Get to sort deferred keys")
+	}
+
+	hash.Add("8")
+	hash.Remove("4")
+	if hash.Get("23") != "6" || hash.Get("27") != "8" {
+		t.Fatal("expect Remove to sort deferred keys before removing")
+	}
+	// 删除不存在的节点不影响其他节点
+	hash.Remove("5")
+	if len(hash.keys) != 9 {
+		t.Fatalf("expect 9 virtual nodes, but %d got", len(hash.keys))
+	}
+
+	batch := New(3, nil)
+	batch.AddBatch([]string{"a", "b"})
+	if batch.dirty || !sort.IntsAreSorted(batch.keys) {
+		t.Fatal("expect AddBatch to sort immediately")
+	}
+}
+
+func nodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = "node" + strconv.Itoa(i)
+	}
+	return nodes
+}
+
+// 每次 Add 之后都 Get，相当于之前每次 Add 都排序
+func BenchmarkAddIncremental(b *testing.B) {
+	nodes := nodes(1000)
+	for i := 0; i < b.N; i++ {
+		m := New(50, nil)
+		for _, node := range nodes {
+			m.Add(node)
+			m.Get("key")
+		}
+	}
+}
+
+func BenchmarkAddDeferred(b *testing.B) {
+	nodes := nodes(1000)
+	for i := 0; i < b.N; i++ {
+		m := New(50, nil)
+		for _, node := range nodes {
+			m.Add(node)
+		}
+		m.Get("key")
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	nodes := nodes(1000)
+	for i := 0; i < b.N; i++ {
+		New(50, nil).AddBatch(nodes)
+	}
+}
+
+func TestGetWithHash(t *testing.T) {
+	hash := New(50, nil)
+	if node, h := hash.GetWithHash("Tom"); node != "" || h != crc32.ChecksumIEEE([]byte("Tom")) {
+		t.Fatalf("expect empty node on empty ring, but %s, %d got", node, h)
+	}
+
+	hash.Add("node1", "node2", "node3")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		node, h := hash.GetWithHash(key)
+		if h != crc32.ChecksumIEEE([]byte(key)) {
+			t.Errorf("hash of %s should be crc32 %d, but %d got", key, crc32.ChecksumIEEE([]byte(key)), h)
+		}
+		if node != hash.Get(key) {
+			t.Errorf("node of %s should be %s, but %s got", key, hash.Get(key), node)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(1, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点为 02, 04, 06
+	hash.Add("2", "4", "6")
+
+	if nodes := hash.GetN("3", 2); !reflect.DeepEqual(nodes, []string{"4", "6"}) {
+		t.Fatalf("expect [4 6], but %v got", nodes)
+	}
+	if nodes := hash.GetN("5", 5); !reflect.DeepEqual(nodes, []string{"6", "2", "4"}) {
+		t.Fatalf("expect all nodes wrapping around, but %v got", nodes)
+	}
+	if nodes := New(1, nil).GetN("5", 2); nodes != nil {
+		t.Fatalf("expect nil on empty ring, but %v got", nodes)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	nodes := []string{"node1", "node2", "node3"}
+	plain, empty := New(50, nil), NewWithSeed(50, nil, "")
+	a, b := NewWithSeed(50, nil, "a"), NewWithSeed(50, nil, "b")
+	for _, m := range []*Map{plain, empty, a, b} {
+		m.Add(nodes...)
+	}
+
+	differ := 0
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if plain.Get(key) != empty.Get(key) {
+			t.Fatalf("expect empty seed to match New for %s", key)
+		}
+		if a.Get(key) != b.Get(key) {
+			differ++
+		}
+	}
+	// 完全独立的分配大约有 2/3 的 key 不同
+	if differ < 300 {
+		t.Fatalf("expect different seeds to route differently, but only %d of 1000 keys differ", differ)
+	}
+}
+
+func TestRemovePreview(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点为 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	want := []Range{{From: 26, To: 2, Owner: "4"}, {From: 6, To: 12, Owner: "4"}, {From: 16, To: 22, Owner: "4"}}
+	if ranges := hash.RemovePreview("2"); !reflect.DeepEqual(ranges, want) {
+		t.Fatalf("expect %v, but %v got", want, ranges)
+	}
+	if ranges := hash.RemovePreview("5"); len(ranges) != 0 {
+		t.Fatalf("expect no ranges for unknown node, but %v got", ranges)
+	}
+
+	ring := New(50, nil)
+	ring.Add("node1", "node2", "node3")
+	ranges := ring.RemovePreview("node2")
+	if len(ranges) != 50 {
+		t.Fatalf("expect 50 ranges, but %d got", len(ranges))
+	}
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := "key" + strconv.Itoa(i)
+		before[key] = ring.Get(key)
+	}
+	ring.Remove("node2")
+	for key, owner := range before {
+		h := crc32.ChecksumIEEE([]byte(key))
+		var moved *Range
+		for i := range ranges {
+			if ranges[i].Contains(h) {
+				moved = &ranges[i]
+				break
+			}
+		}
+		after := ring.Get(key)
+		switch {
+		case owner == "node2" && (moved == nil || moved.Owner != after):
+			t.Fatalf("expect %s to move to %s, but preview %v", key, after, moved)
+		case owner != "node2" && (moved != nil || after != owner):
+			t.Fatalf("expect %s to stay on %s, but %s got, preview %v", key, owner, after, moved)
+		}
+	}
+}
+
+func TestCollision(t *testing.T) {
+	hash := func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	}
+	// 节点 2 的虚拟节点为 2、12，节点 12 的虚拟节点为 12、112，在 12 处冲突
+	ab, ba := New(2, hash), New(2, hash)
+	ab.Add("2", "12")
+	ba.Add("12")
+	ba.Add("2")
+	for _, m := range []*Map{ab, ba} {
+		if len(m.keys) != 3 {
+			t.Fatalf("expect 3 virtual nodes, but %v got", m.keys)
+		}
+		// 字典序较小的 12 胜出，与添加顺序无关
+		if m.Get("11") != "12" || m.Get("1") != "2" || m.Get("100") != "12" {
+			t.Fatalf("expect stable routing, but %s, %s, %s got", m.Get("11"), m.Get("1"), m.Get("100"))
+		}
+	}
+
+	// 胜出的节点被移除后由落选的节点接替
+	ab.Remove("12")
+	if ab.Get("11") != "2" || len(ab.keys) != 2 {
+		t.Fatalf("expect 2 to take over, but %s, %v got", ab.Get("11"), ab.keys)
+	}
+	// 移除落选的节点不影响胜出的节点
+	ba.Remove("2")
+	if ba.Get("11") != "12" || ba.Get("1") != "12" || len(ba.keys) != 2 {
+		t.Fatalf("expect 12 to keep its virtual nodes, but %s, %v got", ba.Get("11"), ba.keys)
+	}
+	ba.Remove("12")
+	if len(ba.keys) != 0 || len(ba.shadowed) != 0 {
+		t.Fatalf("expect empty ring, but %v, %v got", ba.keys, ba.shadowed)
+	}
+}
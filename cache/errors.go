@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// multiError 汇总多个错误
+type multiError []error
+
+func (m multiError) Error() string {
+	if len(m) == 1 {
+		return m[0].Error()
+	}
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// 任意一个错误匹配 target 时返回 true，使 errors.Is 可以检查汇总的错误
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
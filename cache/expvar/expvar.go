@@ -0,0 +1,33 @@
+// Package expvar 通过标准库 expvar 发布 Group 的统计信息，不引入额外的依赖。
+// 引入 net/http/pprof 或 expvar 之后可以在 /debug/vars 中查看
+package expvar
+
+import (
+	"cache"
+	"expvar"
+)
+
+// Publish 以 name 发布一个 expvar.Map，其中每个 Group 对应一个以 Group 名字为 key 的条目，
+// 包含 hits、misses、evictions、bytes 和 entries，每次读取时从 Group 获取最新的值。
+// 与 expvar.Publish 一样，name 重复时会 panic
+func Publish(name string, groups ...*cache.Group) *expvar.Map {
+	m := expvar.NewMap(name)
+	for _, g := range groups {
+		Add(m, g)
+	}
+	return m
+}
+
+// 把 Group 的统计信息加入已发布的 expvar.Map
+func Add(m *expvar.Map, g *cache.Group) {
+	m.Set(g.Name(), expvar.Func(func() interface{} {
+		bytes, entries := g.Size()
+		return map[string]int64{
+			"hits":      g.Stats.Hits.Get(),
+			"misses":    g.Stats.Misses.Get(),
+			"evictions": g.Stats.Evictions.Get(),
+			"bytes":     bytes,
+			"entries":   int64(entries),
+		}
+	}))
+}
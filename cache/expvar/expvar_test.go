@@ -0,0 +1,33 @@
+package expvar
+
+import (
+	"cache"
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	g := cache.NewGroup("expvar", 2<<10, cache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer cache.RemoveGroup("expvar")
+	Publish("geecache_test", g)
+
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("Jack")
+
+	v := expvar.Get("geecache_test").(*expvar.Map).Get("expvar")
+	var stats map[string]int64
+	if err := json.Unmarshal([]byte(v.String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]int64{"hits": 1, "misses": 2, "evictions": 0, "bytes": 14, "entries": 2}
+	for k, want := range expect {
+		if stats[k] != want {
+			t.Fatalf("expect %s = %d, but %v got", k, want, stats)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package fifo
+
+import (
+	"cache/lru"
+	"container/list"
+)
+
+// FIFO 缓存：按添加顺序淘汰，Get 不改变顺序。用作对比其他淘汰算法的基准，当前非线程安全
+type Cache struct {
+	maxBytes int64
+	nbytes   int64
+	ll       *list.List
+	cache    map[string]*list.Element
+	// 可选的方法（回调作用）
+	OnEvicted func(key string, value lru.Value)
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 添加值到缓存中，更新已存在的记录不改变其顺序
+func (c *Cache) Add(key string, value lru.Value) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+	} else {
+		c.cache[key] = c.ll.PushFront(&entry{key, value})
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// 从缓存中获取值
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// 淘汰最早添加的记录
+func (c *Cache) RemoveOldest() {
+	if ele := c.ll.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// 从最新添加到最早添加依次遍历记录，f 返回 false 时停止。
+// 调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value lru.Value) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// 缓存中的记录数
+func (c *Cache) Len() int {
+	return c.ll.Len()
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 缓存中记录（key 和 value）占用的总字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
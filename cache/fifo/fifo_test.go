@@ -0,0 +1,34 @@
+package fifo
+
+import (
+	"cache/lru"
+	"reflect"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestEvictionOrder(t *testing.T) {
+	keys := make([]string, 0)
+	c := New(int64(len("k1v1k2v2k3v3")), func(key string, value lru.Value) {
+		keys = append(keys, key)
+	})
+	c.Add("k1", String("v1"))
+	c.Add("k2", String("v2"))
+	c.Add("k3", String("v3"))
+	// 访问不会改变淘汰顺序
+	c.Get("k1")
+	c.Add("k4", String("v4"))
+	c.Add("k5", String("v5"))
+
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %s, but %s got", expect, keys)
+	}
+	if v, ok := c.Get("k3"); !ok || string(v.(String)) != "v3" || c.Len() != 3 {
+		t.Fatal("expect k3 still cached")
+	}
+}
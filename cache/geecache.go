@@ -1,25 +1,512 @@
 package cache
 
 import (
+	"cache/bloom"
 	pb "cache/geecachepb"
+	"cache/lru"
+	"cache/ratelimit"
 	"cache/singleflight"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math/rand"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// 数据源中不存在 key 时返回的错误
+	ErrNotFound = errors.New("key not found")
+	// 访问数据源的频率超过限制时返回的错误
+	ErrRateLimited = errors.New("origin rate limited")
+	// key 没有通过 WithKeyValidator 设置的校验时返回的错误
+	ErrInvalidKey = errors.New("invalid key")
+	// 注册了节点但节点列表为空时 Ready 返回的错误
+	ErrNoPeers = errors.New("peers registered but peer list is empty")
+	// SetIfVersion 时缓存中的版本号与期望的不一致
+	ErrVersionMismatch = errors.New("version mismatch")
 )
 
 // 缓存的命名空间
 type Group struct {
 	// 缓存的名字
 	name string
-	// 本地缓存未命中时获取源数据的回调（比如从数据库获取）
-	getter Getter
+	// 本地缓存未命中时获取源数据的回调（比如从数据库获取），受 getterMu 保护，见 SetGetter
+	getter   Getter
+	getterMu sync.RWMutex
+	// 每次 SetGetter 加一，写后模式按 (getterVersion, key) 合并写入，不同 getter 的写入互不覆盖。受 getterMu 保护
+	getterVersion uint64
+	// getter 失败时依次尝试的备用数据源
+	fallbacks []Getter
 	// 自己实现的LRU并发缓存
 	mainCache cache
+	// getter 实现了 StreamingGetter 时，超过该字节数的值以流的方式返回而不缓存，0 表示不启用
+	streamThreshold int64
+	// 加载超过该时间且有过期的旧值时返回旧值，0 表示不启用
+	staleOnSlow time.Duration
+	// singleflight 的分片数，大于 0 时使用 singleflight.ShardedGroup
+	loaderShards int
+	// 选择分片的哈希函数，为 nil 时使用 fnv-1a
+	shardHash func(data []byte) uint32
+	// mainCache 的分片数，大于 1 时按一致性哈希分片，见 WithCacheShards
+	cacheShards int
+	// 记录添加到缓存超过该时间后视为未命中，0 表示不限制，见 WithMaxAge
+	maxAge time.Duration
+	// 大于 0 时在后台调用淘汰回调，见 WithAsyncEvictCallbacks
+	asyncEvictBuffer int
+	// 写后模式的写入间隔和批次大小，见 WithWriteBehind
+	writeBehindInterval time.Duration
+	writeBehindBatch    int
+	// 不为 nil 时 Set 在后台写入数据源
+	writeBehind *writeBehind
+	// 是否已经输出过节点列表为空的警告，通过 atomic 访问
+	warnedNoPeers int32
+	// 串行化 SetIfVersion 和 Invalidate
+	casMu sync.Mutex
+	// 从远程节点获取的值的镜像，为 nil 表示不缓存远程节点的值。
+	// 与 mainCache 使用独立的内存上限，互不淘汰
+	hotCache *cache
 	// peers 是 HTTPPOOl 类型，实现了 PeerPicker 接口
 	peers PeerPicker
+	// 取消在 peers 上注册的节点变化回调，RemoveGroup 时调用
+	unwatchRing func()
 	// 让每个 key 在短时间内只会被访问一次
-	loader *singleflight.Group
+	loader flightGroup
+	// LoadOrStore 合并到的加载失败之后写入使用的 singleflight，与 loader 分开，不会再合并到失败的加载
+	storer singleflight.Group
+	// 从本地数据源或远程节点加载到值之后的回调，source 为数据来源
+	onLoad func(key string, source string)
+	// 布隆过滤器的位数和哈希函数个数，bloomBits 为 0 表示不启用
+	bloomBits, bloomHashes uint32
+	// 存放 *bloom.Filter，RebuildBloomFilter 之前为空，不参与判断
+	filter atomic.Value
+	// 限制访问数据源的频率，为 nil 表示不限制
+	limiter *ratelimit.Limiter
+	// 压缩存放在缓存中的值，为 nil 表示不压缩
+	compressor Compressor
+	// 同名 Group 已存在时 panic，而不是返回已存在的 Group
+	panicOnDuplicate bool
+	// 日志输出
+	logger Logger
+	// 是否在每次命中缓存时输出日志，默认关闭
+	logHits bool
+	// 超过该大小的值不会被缓存，0 表示不限制
+	maxValueSize int
+	// 单次添加淘汰的记录数超过该值时记为一次淘汰风暴，0 表示不检测
+	evictionBurst int
+	// 缓存记录的存活时间，0 表示永不过期
+	ttl time.Duration
+	// 存活时间的随机抖动比例（0~1），使同时写入的记录不会同时过期
+	ttlJitter float64
+	// 判断数据源返回的错误是否表示 key 不存在
+	notFound func(err error) bool
+	// 记录不存在的 key，为 nil 表示不启用负缓存
+	negative *negativeCache
+	// 限制同时访问数据源的次数，为 nil 表示不限制
+	loadSem chan struct{}
+	// 向远程节点请求超过该时间还没有返回时，向下一个候选节点发出对冲请求，0 表示不对冲
+	hedgeDelay time.Duration
+	// 所属节点不可用、由本机代为加载之后，是否把值推送给所属节点
+	propagate bool
+	// Invalidate 是否通知其他节点
+	invalidateBroadcast bool
+	// 校验 key，为 nil 表示不校验
+	validateKey func(key string) error
+	// 规范化 key，为 nil 表示不转换，见 WithKeyNormalizer
+	normalizeKey KeyNormalizer
+	// getter 返回 (nil, nil) 时视为 key 不存在，而不是缓存空值
+	nilAsNotFound bool
+
+	// 统计信息
+	Stats Stats
+}
+
+// Stats 是 Group 的统计信息，所有字段都可以并发读取
+type Stats struct {
+	// Get 命中本地缓存的次数（MainHits 与 HotHits 之和）
+	Hits AtomicInt
+	// 命中 mainCache（本机所属的 key）的次数
+	MainHits AtomicInt
+	// 命中 hotCache（远程节点的 key 的镜像）的次数
+	HotHits AtomicInt
+	// Get 未命中本地缓存的次数
+	Misses AtomicInt
+	// 被淘汰的记录总数
+	Evictions AtomicInt
+	// 单次添加淘汰的记录数超过阈值的次数，频繁出现说明缓存容量过小
+	EvictionBursts AtomicInt
+	// 重新获取过期的远程值时，远程节点确认值没有变化的次数，见 ConditionalPeerGetter
+	PeerNotModified AtomicInt
+	// 写后模式下在后台写入数据源失败的次数，见 WithWriteBehind
+	WriteBehindFailures AtomicInt
+}
+
+// 把 o 的各项计数加到 s 上，用于汇总多个 Group 的统计信息。新增字段时需要同时加在这里
+func (s *Stats) add(o *Stats) {
+	s.Hits.Add(o.Hits.Get())
+	s.MainHits.Add(o.MainHits.Get())
+	s.HotHits.Add(o.HotHits.Get())
+	s.Misses.Add(o.Misses.Get())
+	s.Evictions.Add(o.Evictions.Get())
+	s.EvictionBursts.Add(o.EvictionBursts.Get())
+	s.PeerNotModified.Add(o.PeerNotModified.Get())
+	s.WriteBehindFailures.Add(o.WriteBehindFailures.Get())
+}
+
+// AtomicInt 是并发安全的 int64 计数器
+type AtomicInt int64
+
+// 原子地加 n
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// 原子地读取当前值
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// 数据来源：缓存命中、本地数据源或远程节点
+const (
+	SourceHit   = "hit"
+	SourceLocal = "local"
+	SourcePeer  = "peer"
+	// 加载太慢，返回了已经过期的旧值，见 WithStaleOnSlow
+	SourceStale = "stale"
+)
+
+// Info 描述 GetWithInfo 返回的值的来源
+type Info struct {
+	// SourceHit、SourceLocal、SourcePeer 或 SourceStale
+	Source string
+	// 值来自远程节点时为该节点的地址
+	PeerURL string
+	// 加载耗时（包括等待其他相同 key 的请求），命中缓存时为 0
+	LoadLatency time.Duration
+}
+
+// flightGroup 是 singleflight.Group 和 singleflight.ShardedGroup 的公共方法
+type flightGroup interface {
+	Do(key string, fn func() (interface{}, error)) (interface{}, error)
+	Stats() singleflight.Stats
+	HotKeys(n int) []singleflight.KeyStat
+}
+
+// GroupOption 用于在实例化 Group 时修改默认配置
+type GroupOption func(*Group)
+
+// 设置加载到值之后的回调，可用于上报缓存未命中事件
+func WithOnLoad(fn func(key string, source string)) GroupOption {
+	return func(g *Group) {
+		g.onLoad = fn
+	}
+}
+
+// 设置备用数据源，getter 失败时按顺序尝试，第一个成功的结果会被缓存
+func WithFallbackGetters(getters ...Getter) GroupOption {
+	return func(g *Group) {
+		g.fallbacks = append(g.fallbacks, getters...)
+	}
+}
+
+// 启用布隆过滤器，bits 为位数，hashes 为哈希函数个数。
+// 需要调用 RebuildBloomFilter 传入全部已存在的 key 之后才会生效。之后只有写入本机缓存的 key
+// （加载、Set、其他节点推送的值等）会加入过滤器：过滤器是每个节点独立的，
+// 直接写入数据源或只写入其他节点的新 key 在本机重建之前会被判断为不存在
+func WithBloomFilter(bits, hashes uint32) GroupOption {
+	return func(g *Group) {
+		g.bloomBits, g.bloomHashes = bits, hashes
+	}
+}
+
+// 限制每秒访问数据源（getter）的次数，最多允许 burst 次突发访问，
+// 超过限制时 Get 返回 ErrRateLimited。与 singleflight 配合，限制持续的访问压力
+func WithOriginRateLimit(rate float64, burst int) GroupOption {
+	return func(g *Group) {
+		g.limiter = ratelimit.New(rate, burst)
+	}
+}
+
+// 压缩存放在缓存中的值，读取时透明解压
+func WithCompressor(c Compressor) GroupOption {
+	return func(g *Group) {
+		g.compressor = c
+	}
+}
+
+// 设置 Group 的日志输出，传入 NopLogger{} 关闭日志
+func WithGroupLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// 设置是否在每次命中缓存时输出日志。命中是最频繁的路径，默认关闭
+func WithHitLog(enabled bool) GroupOption {
+	return func(g *Group) {
+		g.logHits = enabled
+	}
+}
+
+// 设置可以缓存的值的最大字节数，超过的值仍然返回给调用方但不会被缓存
+func WithMaxValueSize(n int) GroupOption {
+	return func(g *Group) {
+		g.maxValueSize = n
+	}
+}
+
+// 单次添加淘汰的记录数超过 n 时，计入 Stats.EvictionBursts 并输出警告日志
+func WithEvictionBurstThreshold(n int) GroupOption {
+	return func(g *Group) {
+		g.evictionBurst = n
+	}
+}
+
+// 同名 Group 已存在时 NewGroup 会 panic
+func WithPanicOnDuplicate() GroupOption {
+	return func(g *Group) {
+		g.panicOnDuplicate = true
+	}
+}
+
+// 设置缓存淘汰算法，默认为 LRU
+func WithPolicy(newPolicy NewPolicy) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newPolicy = newPolicy
+	}
+}
+
+// 设置缓存记录被淘汰时的回调，回调在释放缓存锁之后调用
+func WithOnEvict(fn func(key string)) GroupOption {
+	return func(g *Group) {
+		g.mainCache.onEvicted = fn
+	}
+}
+
+// 写后模式：getter 实现了 WriteThrough 时，Set 只写缓存并把值放入缓冲区后立即返回，由后台 goroutine
+// 每隔 interval 或积累了 batchSize 个不同的 key（batchSize <= 0 表示只按时间）时写入数据源，
+// 同一个 key 的多次写入只写最后一次的值（SetGetter 前后的写入分别写入各自的数据源）。写入失败时只输出日志并计入 Stats.WriteBehindFailures，Set 不再返回数据源的错误。
+// 值写入数据源之前被淘汰时，Get 可能从数据源读到旧值。Flush 立即写入，RemoveGroup 时写完剩余的值并停止。
+// interval <= 0 时不启用；是否写入数据源由 Set 时的 getter 决定，之后通过 SetGetter 换成实现了 WriteThrough 的 getter 同样生效
+func WithWriteBehind(interval time.Duration, batchSize int) GroupOption {
+	return func(g *Group) {
+		g.writeBehindInterval = interval
+		g.writeBehindBatch = batchSize
+	}
+}
+
+// 淘汰回调（WithOnEvict、WithOnEvictReason）改为在后台 goroutine 中按批次调用：
+// 一次写入淘汰的全部记录作为一个批次，写入方不再等待回调执行，批次内和批次之间仍然保持淘汰顺序。
+// 最多缓冲 buffer 个批次，缓冲区满时写入方等待。RemoveGroup 时调用完缓冲的批次并停止
+func WithAsyncEvictCallbacks(buffer int) GroupOption {
+	return func(g *Group) {
+		if buffer < 1 {
+			buffer = 1
+		}
+		g.asyncEvictBuffer = buffer
+	}
+}
+
+// 设置缓存记录的存活时间，过期的记录在下一次 Get 时重新加载。d <= 0 表示永不过期
+func WithTTL(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = d
+	}
+}
+
+// 为每条记录的存活时间加上 ±percent 的随机抖动（percent 取值 0~1），
+// 避免预热等批量写入的记录同时过期，导致周期性地集中访问数据源。需要配合 WithTTL 使用
+func WithTTLJitter(percent float64) GroupOption {
+	return func(g *Group) {
+		if percent < 0 {
+			percent = 0
+		}
+		if percent > 1 {
+			percent = 1
+		}
+		g.ttlJitter = percent
+	}
+}
+
+// 设置判断数据源返回的错误是否表示 key 不存在的函数，默认使用 errors.Is(err, ErrNotFound)。
+// 不同数据源使用不同的错误时，可以在这里统一判断
+func WithNotFound(fn func(err error) bool) GroupOption {
+	return func(g *Group) {
+		g.notFound = fn
+	}
+}
+
+// 启用负缓存：数据源返回表示 key 不存在的错误（见 WithNotFound）时，在 ttl 内再次访问该 key
+// 直接返回相同的错误，不再访问数据源。其他错误（如超时）不会被缓存。
+// 负缓存的大小限制与 Group 的 cacheBytes 相同
+func WithNegativeCache(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negative = &negativeCache{ttl: ttl}
+	}
+}
+
+// 与 WithNegativeCache 相同，但由 fn 根据数据源返回的错误决定缓存多久，返回 0 表示不缓存。
+// 所有错误都会交给 fn（不只是 WithNotFound 判断为不存在的错误），例如不存在缓存 1 分钟、超时缓存 1 秒
+func WithNegativeCacheFunc(fn func(err error) time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negative = &negativeCache{ttlFunc: fn}
+	}
+}
+
+// 限制同时访问数据源（getter）的次数最多为 n。singleflight 只合并相同 key 的请求，
+// 大量不同的 key 同时未命中时仍会并发访问数据源，该选项限制总的并发数。
+// 超过限制的加载会等待，使用 GetContext 可以在 ctx 取消时停止等待
+func WithMaxConcurrentLoads(n int) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.loadSem = make(chan struct{}, n)
+		}
+	}
+}
+
+// KeyNormalizer 把 key 转换为规范的形式（如转为小写、去掉末尾的 /），等价的 key 共用同一条缓存和同一次加载。
+// 必须是幂等的：对已经规范化的 key 再次转换结果不变
+type KeyNormalizer func(key string) string
+
+// 设置 key 的规范化函数，在校验、访问缓存、选择节点、请求远程节点和调用 getter 之前调用，
+// 缓存和数据源看到的都是规范化之后的 key。所有节点应当使用相同的函数。默认不转换
+func WithKeyNormalizer(fn KeyNormalizer) GroupOption {
+	return func(g *Group) {
+		g.normalizeKey = fn
+	}
+}
+
+// 设置 key 的校验函数，Get 和 Set 在访问缓存和数据源之前调用，返回的错误会被包装为 ErrInvalidKey。
+// 默认不校验。可以使用 KeyLimits 限制长度和字符
+func WithKeyValidator(fn func(key string) error) GroupOption {
+	return func(g *Group) {
+		g.validateKey = fn
+	}
+}
+
+// 返回限制 key 的最大字节数和允许的字符的校验函数，maxLen <= 0 表示不限制长度，
+// allowed 为 nil 表示只拒绝控制字符
+func KeyLimits(maxLen int, allowed func(r rune) bool) func(key string) error {
+	if allowed == nil {
+		allowed = func(r rune) bool { return !unicode.IsControl(r) }
+	}
+	return func(key string) error {
+		if maxLen > 0 && len(key) > maxLen {
+			return fmt.Errorf("key length %d exceeds %d", len(key), maxLen)
+		}
+		for i, r := range key {
+			if r == utf8.RuneError || !allowed(r) {
+				return fmt.Errorf("invalid character %q at %d", r, i)
+			}
+		}
+		return nil
+	}
+}
+
+// 设置记录离开缓存时的回调，同时给出原因：容量淘汰、删除、过期、清空或值被替换。
+// 使用自定义淘汰算法时不会报告 Replaced。回调在释放缓存锁之后调用
+func WithOnEvictReason(fn func(key string, reason lru.Reason)) GroupOption {
+	return func(g *Group) {
+		g.mainCache.onEvictedReason = fn
+	}
+}
+
+// 设置 getter 返回 (nil, nil) 时的处理方式。默认（false）与空值 []byte{} 相同，会被缓存；
+// 为 true 时视为 key 不存在：不缓存，Get 返回 ErrNotFound，并尝试备用数据源和负缓存
+func WithNilAsNotFound(enabled bool) GroupOption {
+	return func(g *Group) {
+		g.nilAsNotFound = enabled
+	}
+}
+
+// 启用对冲请求：向远程节点请求超过 delay 还没有返回时，同时向环上的下一个候选节点发出请求，
+// 使用先返回的结果并取消另一个请求。以少量额外的请求降低尾延迟，需要 PeerPicker 实现 FallbackPicker
+func WithHedging(delay time.Duration) GroupOption {
+	return func(g *Group) {
+		g.hedgeDelay = delay
+	}
+}
+
+// 所属节点不可用、由本机从数据源加载了不属于本机的 key 之后，在后台把值推送给所属节点
+// （只写入其缓存），使之后的请求可以从所属节点获取。需要 PeerGetter 实现 PeerSetter，
+// 使用 HTTPPool 时所属节点需要开启 WithPeerWrites
+func WithPropagateToOwner() GroupOption {
+	return func(g *Group) {
+		g.propagate = true
+	}
+}
+
+// Invalidate 同时通知其他节点删除 key。需要 PeerPicker 实现 PeerLister、PeerGetter 实现
+// PeerInvalidator，使用 HTTPPool 时其他节点需要开启 WithPeerWrites
+func WithInvalidateBroadcast() GroupOption {
+	return func(g *Group) {
+		g.invalidateBroadcast = true
+	}
+}
+
+// 使用分成 n 个分片的 singleflight，大量不同的 key 同时未命中时减少锁竞争
+func WithLoaderShards(n int) GroupOption {
+	return func(g *Group) {
+		g.loaderShards = n
+	}
+}
+
+// 把 mainCache 分成 n 个分片，按与节点路由相同的一致性哈希（crc32，可以通过 WithShardHash 替换）把 key 分到分片，
+// 每个分片有独立的锁和淘汰算法，平分 cacheBytes。并发访问大量不同的 key 时减少锁竞争，
+// 代价是淘汰只在分片内按最近使用排序。n <= 1 表示不分片
+func WithCacheShards(n int) GroupOption {
+	return func(g *Group) {
+		g.cacheShards = n
+	}
+}
+
+// 设置把 key 分到分片使用的哈希函数，同时用于 WithLoaderShards 和 WithCacheShards 的分片，
+// 默认分别为 fnv-1a 和 crc32。
+// 结构化的 key 在默认哈希下分布不均时，可以换用更适合 key 格式的哈希
+func WithShardHash(fn func(data []byte) uint32) GroupOption {
+	return func(g *Group) {
+		g.shardHash = fn
+	}
+}
+
+// 启用 hotCache：从远程节点获取的值同时缓存在本机，最多占用 n 字节，与 mainCache 分别淘汰，
+// 远程的热点 key 不会挤占本机所属的 key。过期的值保留到被淘汰或替换，远程节点实现了
+// ConditionalPeerGetter 时用于条件请求，值没有变化时不再传输。n <= 0 表示不启用
+func WithHotCacheBytes(n int64) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.hotCache = &cache{cacheBytes: n, keepExpired: true}
+		}
+	}
+}
+
+// 设置整个 Group 的最大存活时间：记录添加到缓存（mainCache 和 hotCache）超过 d 之后视为未命中并重新加载，
+// 不论 WithTTL、Touch 等设置的过期时间，两者同时设置时以较早的为准。d <= 0 表示不限制
+func WithMaxAge(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.maxAge = d
+	}
+}
+
+// 数据源变慢时返回旧值：过期的记录先保留在缓存中，重新加载超过 d 还没有完成时返回过期的旧值，
+// 加载在后台继续，完成后更新缓存。与按时间触发的后台刷新不同，只有加载变慢时才会返回旧值。
+// 过期的记录会一直占用缓存直到被淘汰或替换。d <= 0 表示不启用
+func WithStaleOnSlow(d time.Duration) GroupOption {
+	return func(g *Group) {
+		if d > 0 {
+			g.staleOnSlow = d
+			g.mainCache.keepExpired = true
+		}
+	}
 }
 
 // Getter 接口的 Get 方法用于根据 key 获取 value
@@ -36,6 +523,31 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TypedGetter 在返回值的同时返回值的 Content-Type（如 image/png），
+// Group 的 getter 实现了该接口时使用 GetTyped 代替 Get，ServeHTTP 会返回该 Content-Type。
+// 从远程节点获取的值不带 Content-Type
+type TypedGetter interface {
+	GetTyped(key string) (value []byte, contentType string, err error)
+}
+
+// 函数类型实现 TypedGetter 和 Getter 接口，Get 丢弃 Content-Type
+type TypedGetterFunc func(key string) ([]byte, string, error)
+
+func (f TypedGetterFunc) GetTyped(key string) ([]byte, string, error) {
+	return f(key)
+}
+
+func (f TypedGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// WriteThrough 接口的 Put 方法用于将值写入数据源。
+// Group 的 getter 同时实现了该接口时，Set 会先写数据源再写缓存
+type WriteThrough interface {
+	Put(key string, value []byte) error
+}
+
 var (
 	// 互斥锁
 	mu sync.RWMutex
@@ -43,8 +555,9 @@ var (
 	groups = make(map[string]*Group)
 )
 
-// 实例化Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// 实例化Group。同名的 Group 已存在时直接返回已存在的 Group（忽略本次传入的参数），
+// 使用 WithPanicOnDuplicate 时改为 panic
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -56,8 +569,44 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 	g := &Group{
 		name:      name,
 		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
+		mainCache: cache{cacheBytes: cacheBytes, tags: &lazyTags{}},
 		loader:    &singleflight.Group{},
+		logger:    stdLogger{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.loaderShards > 0 {
+		g.loader = singleflight.NewShardedWithHash(g.loaderShards, g.shardHash)
+	}
+	if g.maxAge > 0 {
+		g.mainCache.maxAge = g.maxAge
+		if g.hotCache != nil {
+			g.hotCache.maxAge = g.maxAge
+		}
+	}
+	g.mainCache.split(g.cacheShards, g.shardHash)
+	if g.notFound == nil {
+		g.notFound = isNotFound
+	}
+	if g.negative != nil {
+		g.negative.maxBytes = cacheBytes
+	}
+	if old, ok := groups[name]; ok {
+		if g.panicOnDuplicate {
+			panic("duplicate registration of group " + name)
+		}
+		return old
+	}
+	if g.asyncEvictBuffer > 0 {
+		g.mainCache.startAsyncNotify(g.asyncEvictBuffer)
+	}
+	if g.writeBehindInterval > 0 {
+		g.writeBehind = newWriteBehind(g.writeBehindInterval, g.writeBehindBatch, func(key string, err error) {
+			g.Stats.WriteBehindFailures.Add(1)
+			g.logger.Printf("[GeeCache] Failed to write %s behind %v", key, err)
+		})
+		g.writeBehind.start()
 	}
 	groups[name] = g
 	return g
@@ -71,20 +620,538 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// 返回按名字排序的全部 Group
+func ListGroups() []string {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// 清空 Group 的缓存并从注册表中删除，Group 不存在时返回 false
+// 清理在释放注册表的锁之后进行：写入数据源和淘汰回调可能很慢，也可能再次访问注册表（如 GetGroup）
+func RemoveGroup(name string) bool {
+	mu.Lock()
+	g, ok := groups[name]
+	if ok {
+		delete(groups, name)
+	}
+	mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	// 节点变化不再需要清理已删除的 Group 的缓存，也不再让 HTTPPool 持有它
+	if g.unwatchRing != nil {
+		g.unwatchRing()
+	}
+	if g.writeBehind != nil {
+		g.writeBehind.stop()
+	}
+	g.mainCache.clear()
+	g.mainCache.stopAsyncNotify()
+	if g.hotCache != nil {
+		g.hotCache.clear()
+	}
+	return true
+}
+
 // 根据 key 获取 cache 中的 value
 func (g *Group) Get(key string) (ByteView, error) {
+	v, _, err := g.get(context.Background(), key)
+	return v, err
+}
+
+// 批量获取多个 key，返回获取成功的值，以及全部失败的 key 的错误（没有失败时为 nil）。
+// 未命中的 key 并发地逐个加载，与 Get 共用同一个 singleflight，
+// 同时通过 Get 和 GetMulti 请求的 key 只会加载一次
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs multiError
+	)
+	values := make(map[string]ByteView, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			v, _, err := g.get(context.Background(), key)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("get %s: %w", key, err))
+				return
+			}
+			values[key] = v
+		}(key)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return values, nil
+	}
+	return values, errs
+}
+
+// 与 Get 相同，直接返回值的拷贝，调用方可以随意修改
+func (g *Group) GetBytes(key string) ([]byte, error) {
+	v, err := g.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return v.ByteSlice(), nil
+}
+
+// 与 Get 相同，ctx 取消时停止等待访问数据源的名额（见 WithMaxConcurrentLoads）并返回 ctx.Err()。
+// 相同 key 的并发请求共享第一个请求的 ctx
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	v, _, err := g.get(ctx, key)
+	return v, err
+}
+
+// 与 Get 相同，同时返回值在本机缓存中的剩余存活时间，用于设置下游的 Cache-Control max-age。
+// 未设置 TTL 或值刚从远程节点获取（本机不知道它的过期时间）时为 lru.NoTTL
+func (g *Group) GetWithTTL(key string) (ByteView, time.Duration, error) {
+	v, err := g.Get(key)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	return v, lru.TTL(v), nil
+}
+
+// 只从本地缓存获取 key 对应的值，不存在或已过期时返回 false，不会访问数据源或远程节点。
+// 与 Get 一样算作一次访问，会更新记录在淘汰算法中的位置
+func (g *Group) GetIfPresent(key string) (ByteView, bool) {
+	key = g.normalize(key)
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, false
+	}
+	v, _, ok := g.lookupCache(key)
+	return v, ok
+}
+
+// 与 Get 相同，同时返回值的来源（缓存命中、本地数据源或远程节点）和加载耗时
+func (g *Group) GetWithInfo(key string) (ByteView, Info, error) {
+	return g.get(context.Background(), key)
+}
+
+// Get、GetContext、GetWithInfo 和 GetMulti 都经过这里。命中缓存时除了缓存自身的锁之外不获取任何锁，
+// 也不会进入 loader（singleflight）：只有未命中时才调用 load。之后的修改（如过期后后台刷新）
+// 也必须保持这一点，BenchmarkGetHit 会检查
+func (g *Group) get(ctx context.Context, key string) (ByteView, Info, error) {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return ByteView{}, Info{}, err
 	}
 
 	// 从缓存中获取到了就直接返回
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
-		return v, nil
+	if v, hot, ok := g.lookupCache(key); ok {
+		g.Stats.Hits.Add(1)
+		if hot {
+			g.Stats.HotHits.Add(1)
+		} else {
+			g.Stats.MainHits.Add(1)
+		}
+		if g.logHits {
+			g.logger.Printf("[GeeCache] hit")
+		}
+		return v, Info{Source: SourceHit}, nil
+	}
+	g.Stats.Misses.Add(1)
+
+	// 布隆过滤器判断一定不存在的 key 直接返回，不再访问数据源
+	if f := g.bloomFilter(); f != nil && !f.MayContain(key) {
+		return ByteView{}, Info{}, ErrNotFound
+	}
+	// 负缓存中记录的不存在的 key 返回原来的错误，与布隆过滤器一样没有数据来源
+	if g.negative != nil {
+		if err := g.negative.get(key); err != nil {
+			return ByteView{}, Info{}, err
+		}
+	}
+
+	if g.staleOnSlow > 0 {
+		if stale, ok := g.mainCache.getStale(key); ok {
+			if stale, ok := g.decompress(key, stale); ok {
+				return g.loadOrStale(key, stale)
+			}
+		}
 	}
 
 	// 获取不到就加载尝试去加载（从其他节点去获取缓存）
-	return g.load(key)
+	start := time.Now()
+	v, info, err := g.load(ctx, key)
+	info.LoadLatency = time.Since(start)
+	return v, info, err
+}
+
+// 加载 key，超过 staleOnSlow 还没有完成时返回过期的旧值 stale，加载在后台继续并更新缓存。
+// 后台加载不受调用方 ctx 的影响
+func (g *Group) loadOrStale(key string, stale ByteView) (ByteView, Info, error) {
+	type result struct {
+		value ByteView
+		info  Info
+		err   error
+	}
+	// 带缓冲，返回旧值之后后台加载完成时不会阻塞
+	ch := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		v, info, err := g.load(context.Background(), key)
+		ch <- result{v, info, err}
+	}()
+
+	t := time.NewTimer(g.staleOnSlow)
+	defer t.Stop()
+	select {
+	case res := <-ch:
+		res.info.LoadLatency = time.Since(start)
+		return res.value, res.info, res.err
+	case <-t.C:
+		return stale, Info{Source: SourceStale, LoadLatency: time.Since(start)}, nil
+	}
+}
+
+// 返回规范化之后的 key，没有设置 KeyNormalizer 时原样返回
+func (g *Group) normalize(key string) string {
+	if g.normalizeKey == nil {
+		return key
+	}
+	return g.normalizeKey(key)
+}
+
+// 检查 key 不为空并且通过 validateKey 的校验
+func (g *Group) checkKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.validateKey != nil {
+		if err := g.validateKey(key); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+	}
+	return nil
+}
+
+// 替换数据源，不影响已经缓存的值。正在进行的加载使用替换前的 getter 完成，之后的加载使用新的 getter。
+// 写后模式（WithWriteBehind）下已经缓冲的值仍然写入放入缓冲区时的数据源，新的 getter 没有实现 WriteThrough 时也不会丢失
+func (g *Group) SetGetter(getter Getter) {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	g.getterMu.Lock()
+	g.getter = getter
+	g.getterVersion++
+	g.getterMu.Unlock()
+}
+
+// 返回当前的 getter
+func (g *Group) loadGetter() Getter {
+	g.getterMu.RLock()
+	defer g.getterMu.RUnlock()
+	return g.getter
+}
+
+// 返回 Group 的名字
+func (g *Group) Name() string {
+	return g.name
+}
+
+// 返回缓存当前占用的字节数（启用压缩时为压缩后的大小）和记录数
+func (g *Group) Size() (bytes int64, entries int) {
+	return g.mainCache.size()
+}
+
+// 返回缓存中的记录数（包括已过期但还没有被删除的记录），可以与 Get、Set 并发调用
+func (g *Group) Len() int {
+	_, entries := g.mainCache.size()
+	return entries
+}
+
+// 从最近使用到最久未使用返回缓存中最多 limit 个未过期的 key，limit <= 0 表示全部返回。
+// 启用 WithCacheShards 时依次返回各个分片的 key，只在每个分片内按最近使用排序，limit 截取的不是全局最近使用的 key。
+// 只用于调试和管理界面，不会改变记录在淘汰算法中的位置，不包括 hotCache 中的 key
+func (g *Group) Keys(limit int) []string {
+	return g.mainCache.recentKeys(limit)
+}
+
+// 返回 hotCache 当前占用的字节数和记录数，未通过 WithHotCacheBytes 启用时均为 0
+func (g *Group) HotSize() (bytes int64, entries int) {
+	if g.hotCache == nil {
+		return 0, 0
+	}
+	return g.hotCache.size()
+}
+
+// 将缓存中 key 的存活时间重新设为 ttl（从现在开始计算），不重新加载值，用于滑动过期。
+// ttl <= 0 表示永不过期。key 不在缓存中或已过期时返回 false
+func (g *Group) Touch(key string, ttl time.Duration) bool {
+	key = g.normalize(key)
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	return g.mainCache.touch(key, expire)
+}
+
+// 返回 singleflight 的统计信息：正在进行中的加载数和被合并的请求数
+func (g *Group) LoaderStats() singleflight.Stats {
+	return g.loader.Stats()
+}
+
+// 返回未命中时被合并次数最多的最多 n 个 key，即大量请求同时等待加载的热点 key，
+// 可以考虑为它们开启 hotCache 或延长 TTL。只统计最近固定数量的 key，次数是近似值
+func (g *Group) HotKeys(n int) []singleflight.KeyStat {
+	return g.loader.HotKeys(n)
+}
+
+// 返回缓存的最大字节数，0 表示不限制
+func (g *Group) Capacity() int64 {
+	return g.mainCache.cacheBytes
+}
+
+// 使用数据源中全部已存在的 key 重建布隆过滤器，批量修改数据源之后需要调用。
+// 未通过 WithBloomFilter 启用时不做任何事
+func (g *Group) RebuildBloomFilter(keys []string) {
+	if g.bloomBits == 0 {
+		return
+	}
+	f := bloom.New(g.bloomBits, g.bloomHashes)
+	for _, key := range keys {
+		f.Add(g.normalize(key))
+	}
+	g.filter.Store(f)
+}
+
+func (g *Group) bloomFilter() *bloom.Filter {
+	f, _ := g.filter.Load().(*bloom.Filter)
+	return f
+}
+
+// 设置 key 对应的值。若 getter 实现了 WriteThrough 接口，先写入数据源，
+// 写入失败时不更新缓存并返回错误（启用 WithWriteBehind 时改为在后台写入）。记录原有的标签被清除
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetWithTags(key, value)
+}
+
+// 与 Set 相同，同时给记录打上标签，之后可以用 InvalidateTag 删除带有某个标签的全部记录。
+// 标签只属于本机缓存中的这条记录：记录被淘汰、过期、删除或被替换（包括重新加载）时标签随之清除
+func (g *Group) SetWithTags(key string, value []byte, tags ...string) error {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	if err := g.put(key, value); err != nil {
+		return err
+	}
+	if g.negative != nil {
+		g.negative.remove(key)
+	}
+	g.populateCacheWithTags(key, ByteView{b: cloneBytes(value)}, tags)
+	return nil
+}
+
+// 与 Get 相同，同时返回值在本机缓存中的版本号，配合 SetIfVersion 实现 compare-and-swap。
+// 每次写入缓存都会分配新的、单调递增的版本号；值没有缓存在本机（如属于远程节点或超过
+// maxValueSize）时版本号为 0
+func (g *Group) GetWithVersion(key string) (ByteView, uint64, error) {
+	key = g.normalize(key)
+	v, err := g.Get(key)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	if v.v == 0 {
+		// 刚加载的值在写入缓存时才分配版本号，重新读取缓存，保证值与版本号一致
+		if cached, ok := g.lookupCacheIn(&g.mainCache, key); ok {
+			v = cached
+		}
+	}
+	return v, v.v, nil
+}
+
+// 只在本机缓存中 key 的版本号等于 expected 时写入（同 Set，实现了 WriteThrough 时先写数据源），
+// 否则返回 ErrVersionMismatch，避免两个写入方互相覆盖。expected 为 0 表示 key 不在缓存中。
+// 并发的 SetIfVersion 之间是串行的；版本号只在写入数据源之前检查一次，写入成功后总是写入缓存。版本号只在本机内有效
+func (g *Group) SetIfVersion(key string, value []byte, expected uint64) error {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	g.casMu.Lock()
+	defer g.casMu.Unlock()
+	if g.mainCache.currentVersion(key) != expected {
+		return ErrVersionMismatch
+	}
+	if err := g.put(key, value); err != nil {
+		return err
+	}
+	if g.negative != nil {
+		g.negative.remove(key)
+	}
+	// 数据源已经写入成功，缓存必须与之一致：即使写入期间版本号被加载或 Set 修改，也不再报告冲突
+	g.populateCache(key, ByteView{b: cloneBytes(value)})
+	return nil
+}
+
+// 预热缓存：以最多 concurrency 个并发通过正常的加载流程（singleflight、节点选择）
+// 加载 keys，返回遇到的第一个错误。ctx 取消后不再发起新的加载并返回 ctx.Err()
+func (g *Group) Warm(ctx context.Context, keys []string, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	setErr := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+	}
+	sem := make(chan struct{}, concurrency)
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			setErr(ctx.Err())
+			break
+		}
+		select {
+		case <-ctx.Done():
+			setErr(ctx.Err())
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func(key string) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if _, err := g.GetContext(ctx, key); err != nil {
+					setErr(fmt.Errorf("warm %s: %v", key, err))
+				}
+			}(key)
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// 按所属节点对 keys 分组，并发地让每个远程节点加载属于它的 key，属于本机的 key 在本地加载，
+// 使整个集群并行预热、每个节点只缓存自己的部分。最多同时发起 concurrency 个请求，返回全部错误
+func (g *Group) LoadAll(ctx context.Context, keys []string, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg   sync.WaitGroup
+		emu  sync.Mutex
+		errs multiError
+	)
+	addErr := func(err error) {
+		emu.Lock()
+		errs = append(errs, err)
+		emu.Unlock()
+	}
+	sem := make(chan struct{}, concurrency)
+
+loop:
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			addErr(ctx.Err())
+			break
+		}
+		key := g.normalize(key)
+		var peer PeerGetter
+		if g.peers != nil {
+			peer, _ = g.peers.PickPeer(key)
+		}
+		// 并发数已满时等待，ctx 取消后不再发起新的加载
+		select {
+		case <-ctx.Done():
+			addErr(ctx.Err())
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(key string, peer PeerGetter) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var err error
+			if peer != nil {
+				_, err = g.getFromPeer(ctx, peer, key)
+			} else {
+				_, err = g.GetContext(ctx, key)
+			}
+			if err != nil {
+				addErr(fmt.Errorf("load %s: %v", key, err))
+			}
+		}(key, peer)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// 扩容时预热新节点：previous 是加入本机之前的节点选择（如只包含旧节点的 HTTPPool），
+// keys 中在新的节点选择下属于本机的 key 会从它在 previous 中的所属节点复制到本机缓存，
+// 不经过本地数据源。需要在旧节点切换到新的节点列表之前调用，否则旧节点已经删除了不再属于它的缓存。
+// limiter 不为 nil 时限制请求旧节点的速率。ctx 取消后停止，返回复制的 key 数和遇到的全部错误
+func (g *Group) WarmFromPeers(ctx context.Context, previous PeerPicker, keys []string, limiter *ratelimit.Limiter) (int, error) {
+	var (
+		copied int
+		errs   multiError
+	)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		key := g.normalize(key)
+		if g.peers != nil {
+			if _, ok := g.peers.PickPeer(key); ok {
+				// 不属于本机
+				continue
+			}
+		}
+		peer, ok := previous.PickPeer(key)
+		if !ok {
+			// 之前也属于本机
+			continue
+		}
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		value, err := g.getFromPeer(ctx, peer, key)
+		if err != nil {
+			if !g.notFound(err) {
+				errs = append(errs, fmt.Errorf("warm %s: %v", key, err))
+			}
+			continue
+		}
+		if err := g.fill(key, value.b); err != nil {
+			errs = append(errs, fmt.Errorf("warm %s: %v", key, err))
+			continue
+		}
+		copied++
+	}
+	if len(errs) == 0 {
+		return copied, nil
+	}
+	return copied, errs
 }
 
 // 将实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中
@@ -93,60 +1160,564 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 		panic("RegisterPeerPicker called more than once")
 	}
 	g.peers = peers
+	if w, ok := peers.(RingWatcher); ok {
+		g.unwatchRing = w.OnRingChange(g.dropUnowned)
+	}
+}
+
+// 检查节点配置：注册了节点（RegisterPeers）但节点列表为空时返回 ErrNoPeers，
+// 此时所有 key 都从本地数据源加载，集群实际以单机模式运行，通常是忘记调用 HTTPPool.Set。
+// 没有注册节点（单机部署）或 PeerPicker 没有实现 PeerCounter 时返回 nil。可用于就绪检查
+func (g *Group) Ready() error {
+	if g.peers == nil {
+		return nil
+	}
+	if c, ok := g.peers.(PeerCounter); ok && c.PeerCount() == 0 {
+		return ErrNoPeers
+	}
+	return nil
+}
+
+// 注册了节点但节点列表为空时输出一次警告
+func (g *Group) warnNoPeers() {
+	if g.peers == nil || atomic.LoadInt32(&g.warnedNoPeers) == 1 {
+		return
+	}
+	if g.Ready() == ErrNoPeers && atomic.CompareAndSwapInt32(&g.warnedNoPeers, 0, 1) {
+		g.logger.Printf("[GeeCache] group %s: peers registered but peer list is empty, running as a single node", g.name)
+	}
+}
+
+// 节点变化之后，删除不再属于本机的缓存，之后的 Get 会从新的所属节点获取，避免返回旧值
+func (g *Group) dropUnowned() {
+	for _, key := range g.mainCache.keys() {
+		if _, ok := g.peers.PickPeer(key); ok {
+			g.mainCache.remove(key)
+		}
+	}
+	// 远程 key 的所属节点可能已经变化
+	if g.hotCache != nil {
+		g.hotCache.clear()
+	}
 }
 
 // 使用 PickPeer() 方法选择节点，若非本机节点，则调用 getFromPeer()
 // 从远程获取。若是本机节点或失败，则回退到 getLocally()
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (ByteView, Info, error) {
 	// 方法传参让 g.loader.Do 去调用，确保每个 key 在短时间内只会被访问一次
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	resi, err := g.loader.Do(key, func() (interface{}, error) {
+		// key 所属的远程节点，从该节点获取失败时不为 nil
+		var owner PeerGetter
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+				owner = peer
+				var (
+					value  ByteView
+					err    error
+					hedged bool
+				)
+				if g.hedgeDelay > 0 {
+					value, peer, hedged, err = g.hedgedGetFromPeer(ctx, peer, key)
+				} else {
+					value, err = g.getFromPeer(ctx, peer, key)
+				}
+				if err == nil {
+					g.populateHotCache(key, value)
+					g.loaded(key, SourcePeer)
+					return loadResult{value, Info{Source: SourcePeer, PeerURL: peerURL(peer)}}, nil
+				}
+				g.logger.Printf("[GeeCache] Failed to get from peer %v", err)
+				// 首选节点暂时不可用时，先尝试环上的下一个节点，再回退到本地数据源。
+				// 已经发出过对冲请求时下一个节点也已经失败，不再重试
+				if fp, ok := g.peers.(FallbackPicker); ok && !hedged && retryable(err) {
+					if peer, ok := fp.PickFallbackPeer(key); ok {
+						value, err := g.getFromPeer(ctx, peer, key)
+						if err == nil {
+							g.populateHotCache(key, value)
+							g.loaded(key, SourcePeer)
+							return loadResult{value, Info{Source: SourcePeer, PeerURL: peerURL(peer)}}, nil
+						}
+						g.logger.Printf("[GeeCache] Failed to get from fallback peer %v", err)
+					}
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
 			}
 		}
 
-		return g.getLocally(key)
+		g.warnNoPeers()
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if g.propagate && owner != nil {
+			go g.propagateToOwner(owner, key, value)
+		}
+		g.loaded(key, SourceLocal)
+		return loadResult{value, Info{Source: SourceLocal}}, nil
 	})
 
-	if err == nil {
-		return viewi.(ByteView), nil
+	if err != nil {
+		return ByteView{}, Info{}, err
+	}
+	// 与并发的 LoadOrStore 合并时得到它写入缓存的值
+	if res, ok := resi.(storeResult); ok {
+		return res.value, Info{Source: SourceHit}, nil
 	}
-	return
+	res := resi.(loadResult)
+	return res.value, res.info, nil
 }
 
-// 调用 g.getter.Get() 获取源数据，并且将源数据添加到缓存 mainCache 中
-func (g *Group) getLocally(key string) (ByteView, error) {
-	// 调用函数类型的实现的 Get 方法获取值
-	bytes, err := g.getter.Get(key)
+// 从 peer 获取值，超过 hedgeDelay 还没有返回时向下一个候选节点发出对冲请求，
+// 使用先成功返回的结果并取消另一个请求。返回提供值的节点，以及是否发出了对冲请求
+func (g *Group) hedgedGetFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, PeerGetter, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// 返回时取消输掉的请求
+	defer cancel()
+
+	type result struct {
+		value ByteView
+		peer  PeerGetter
+		err   error
+	}
+	// 带缓冲，输掉的请求返回时不会阻塞
+	ch := make(chan result, 2)
+	fetch := func(p PeerGetter) {
+		v, err := g.getFromPeer(ctx, p, key)
+		ch <- result{v, p, err}
+	}
+	go fetch(peer)
+
+	timer := time.NewTimer(g.hedgeDelay)
+	defer timer.Stop()
+	pending, hedged := 1, false
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-ch:
+			pending--
+			if r.err == nil {
+				return r.value, r.peer, hedged, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		case <-timer.C:
+			fp, ok := g.peers.(FallbackPicker)
+			if !ok {
+				continue
+			}
+			if next, ok := fp.PickFallbackPeer(key); ok {
+				hedged = true
+				pending++
+				go fetch(next)
+			}
+		}
+	}
+	return ByteView{}, nil, hedged, firstErr
+}
+
+// 把本机代为加载的值写入所属节点的缓存，失败时只输出日志
+func (g *Group) propagateToOwner(owner PeerGetter, key string, value ByteView) {
+	ps, ok := owner.(PeerSetter)
+	if !ok {
+		return
+	}
+	if err := ps.Set(&pb.Request{Group: g.name, Key: key}, value.b); err != nil {
+		g.logger.Printf("[GeeCache] Failed to propagate %s to %s %v", key, peerURL(owner), err)
+	}
+}
+
+// 从本机彻底删除 key：mainCache、hotCache 和负缓存中的记录都被删除，之后的 Get 会重新加载，
+// 不修改数据源。使用 WithInvalidateBroadcast 时同时通知其他节点删除，返回第一个失败的节点的错误。
+// 与 Set 一样，正在进行的加载完成后仍可能写入加载到的值
+func (g *Group) Invalidate(key string) error {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	g.invalidateLocal(key)
+	if !g.invalidateBroadcast {
+		return nil
+	}
+	pl, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var first error
+	for _, peer := range pl.ListPeers() {
+		pi, ok := peer.(PeerInvalidator)
+		if !ok {
+			continue
+		}
+		if err := pi.Invalidate(&pb.Request{Group: g.name, Key: key}); err != nil {
+			g.logger.Printf("[GeeCache] Failed to invalidate %s on %s %v", key, peerURL(peer), err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// getter 实现了 WriteThrough 时把值写入数据源，写后模式下放入缓冲区后立即返回
+func (g *Group) put(key string, value []byte) error {
+	g.getterMu.RLock()
+	getter, version := g.getter, g.getterVersion
+	g.getterMu.RUnlock()
+	w, ok := getter.(WriteThrough)
+	if !ok {
+		return nil
+	}
+	if g.writeBehind != nil && g.writeBehind.enqueue(w, version, key, cloneBytes(value)) {
+		return nil
+	}
+	return w.Put(key, value)
+}
+
+// 立即把写后模式缓冲的值写入数据源，写入完成后返回。没有启用写后模式时直接返回
+func (g *Group) Flush() {
+	if g.writeBehind != nil {
+		g.writeBehind.flush()
+	}
+}
+
+// 删除本机缓存中带有 tag 的全部记录（见 SetWithTags），与 Invalidate 一样清除各层缓存，
+// 不通知其他节点。返回删除的 key，按字典序排列
+func (g *Group) InvalidateTag(tag string) []string {
+	tags := g.mainCache.loadTags()
+	if tags == nil {
+		return nil
+	}
+	keys := tags.take(tag)
+	for _, key := range keys {
+		g.invalidateLocal(key)
+	}
+	return keys
+}
+
+// 删除本机各层缓存中的 key，不通知其他节点
+func (g *Group) invalidateLocal(key string) {
+	g.casMu.Lock()
+	defer g.casMu.Unlock()
+	g.mainCache.remove(key)
+	if g.hotCache != nil {
+		g.hotCache.remove(key)
+	}
+	if g.negative != nil {
+		g.negative.remove(key)
+	}
+}
+
+// 其他节点推送的值，只写入缓存，不写数据源
+func (g *Group) fill(key string, value []byte) error {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	if g.negative != nil {
+		g.negative.remove(key)
+	}
+	g.populateCache(key, ByteView{b: cloneBytes(value)})
+	return nil
+}
+
+// 在 key 的 singleflight 中执行 fn，并把返回的值写入缓存（不写数据源），用于“只计算一次并缓存”
+// 这类不经过 getter 的工作。不读取缓存，与同一个 key 上正在进行的 Get、LoadOrStore 和 Do 合并：
+// 同时只有一个在执行，其他调用方得到它的结果。fn 返回错误时不写入缓存
+func (g *Group) Do(key string, fn func() (ByteView, error)) (ByteView, error) {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return ByteView{}, err
+	}
+	resi, err := g.loader.Do(key, func() (interface{}, error) {
+		v, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		// 只保留值和 Content-Type，过期时间和版本号在写入缓存时重新设置
+		v = ByteView{b: v.b, ct: v.ct}
+		if g.negative != nil {
+			g.negative.remove(key)
+		}
+		g.populateCache(key, v)
+		return loadResult{v, Info{Source: SourceLocal}}, nil
+	})
 	if err != nil {
 		return ByteView{}, err
+	}
+	switch res := resi.(type) {
+	case storeResult:
+		return res.value, nil
+	case loadResult:
+		return res.value, nil
+	}
+	return ByteView{}, nil
+}
+
+// 返回缓存中 key 的值（loaded 为 true），不存在时把 value 写入缓存并返回它（loaded 为 false），
+// 不调用 getter，也不写入数据源（与 sync.Map.LoadOrStore 相同）。与 Get 共用 singleflight：
+// 并发的 LoadOrStore 和正在进行的加载只会有一个值胜出，所有调用方都得到这个值。key 无效时不写入，直接返回 value
+func (g *Group) LoadOrStore(key string, value []byte) (actual ByteView, loaded bool) {
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return ByteView{b: cloneBytes(value)}, false
+	}
+	if v, _, ok := g.lookupCache(key); ok {
+		return v, true
+	}
+	// 区分本次调用写入的值和其他调用方的结果
+	token := new(byte)
+	store := func() (interface{}, error) {
+		if v, ok := g.lookupCacheIn(&g.mainCache, key); ok {
+			return storeResult{value: v}, nil
+		}
+		if g.negative != nil {
+			g.negative.remove(key)
+		}
+		v := ByteView{b: cloneBytes(value)}
+		g.populateCache(key, v)
+		return storeResult{value: v, storedBy: token}, nil
+	}
+	resi, err := g.loader.Do(key, store)
+	if err != nil {
+		// 合并到的加载失败了：改为通过 storer 写入，不再重试 loader，避免 key 持续加载失败时一直重试。
+		// 这些调用方之间仍然只有一个写入，其他调用方得到它的值。store 不会返回错误
+		resi, _ = g.storer.Do(key, store)
+	}
+	switch res := resi.(type) {
+	case storeResult:
+		return res.value, res.storedBy != token
+	case loadResult:
+		return res.value, true
+	}
+	return ByteView{}, false
+}
+
+// LoadOrStore 在 loader.Do 中返回的结果，storedBy 是写入该值的调用方的标记，读取到已有的值时为 nil
+type storeResult struct {
+	value    ByteView
+	storedBy *byte
+}
 
+// loader.Do 返回的加载结果
+type loadResult struct {
+	value ByteView
+	info  Info
+}
+
+// 调用 onLoad 回调
+func (g *Group) loaded(key string, source string) {
+	if f := g.bloomFilter(); f != nil {
+		f.Add(key)
+	}
+	if g.onLoad != nil {
+		g.onLoad(key, source)
+	}
+}
+
+// 调用 g.getter.Get() 获取源数据，并且将源数据添加到缓存 mainCache 中
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	if g.limiter != nil && !g.limiter.Allow() {
+		return ByteView{}, ErrRateLimited
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	if g.loadSem != nil {
+		select {
+		case g.loadSem <- struct{}{}:
+			defer func() { <-g.loadSem }()
+		case <-ctx.Done():
+			return ByteView{}, ctx.Err()
+		}
+	}
+	// 调用函数类型的实现的 Get 方法获取值，失败时依次尝试备用数据源
+	bytes, ct, err := g.getFrom(g.loadGetter(), key)
+	for i := 0; err != nil && i < len(g.fallbacks); i++ {
+		bytes, ct, err = g.getFrom(g.fallbacks[i], key)
+	}
+	if err != nil {
+		if g.negative != nil {
+			if ttl := g.negative.ttlFor(err, g.notFound); ttl > 0 {
+				g.negative.add(key, err, ttl)
+			}
+		}
+		return ByteView{}, err
+	}
+	// 返回的值与缓存中的值使用相同的过期时间
+	value := ByteView{b: cloneBytes(bytes), ct: ct, e: g.expireTime()}
 	g.populateCache(key, value)
 	return value, nil
 }
 
-// 添加缓存到 mainCache 中
+// 从 getter 获取值，启用 WithNilAsNotFound 时把 (nil, nil) 转换为 ErrNotFound
+func (g *Group) getFrom(getter Getter, key string) ([]byte, string, error) {
+	bytes, ct, err := getTyped(getter, key)
+	if err == nil && bytes == nil && g.nilAsNotFound {
+		return nil, "", fmt.Errorf("getter returned nil for %s: %w", key, ErrNotFound)
+	}
+	return bytes, ct, err
+}
+
+// getter 实现了 TypedGetter 时同时返回 Content-Type，否则 Content-Type 为空
+func getTyped(getter Getter, key string) ([]byte, string, error) {
+	if tg, ok := getter.(TypedGetter); ok {
+		return tg.GetTyped(key)
+	}
+	b, err := getter.Get(key)
+	return b, "", err
+}
+
+// 依次从 mainCache 和 hotCache 中获取缓存，hot 表示命中的是 hotCache
+func (g *Group) lookupCache(key string) (value ByteView, hot bool, ok bool) {
+	if v, ok := g.lookupCacheIn(&g.mainCache, key); ok {
+		return v, false, true
+	}
+	if g.hotCache != nil {
+		if v, ok := g.lookupCacheIn(g.hotCache, key); ok {
+			return v, true, true
+		}
+	}
+	return ByteView{}, false, false
+}
+
+// 从 c 中获取缓存，启用压缩时解压，解压失败视为未命中
+func (g *Group) lookupCacheIn(c *cache, key string) (ByteView, bool) {
+	v, ok := c.get(key)
+	if !ok {
+		return v, ok
+	}
+	return g.decompress(key, v)
+}
+
+// 启用压缩时解压缓存中的值，解压失败视为未命中
+func (g *Group) decompress(key string, v ByteView) (ByteView, bool) {
+	if g.compressor == nil {
+		return v, true
+	}
+	b, err := g.compressor.Decompress(v.b)
+	if err != nil {
+		g.logger.Printf("[GeeCache] Failed to decompress %s %v", key, err)
+		return ByteView{}, false
+	}
+	v.b = b
+	return v, true
+}
+
+// 添加缓存到 mainCache 中，启用压缩时存放压缩后的值。超过 maxValueSize 的值不会被缓存，
+// 同时删除 key 原有的记录，避免之后返回旧值
 func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+	g.populateCacheWithTags(key, value, nil)
+}
+
+// 与 populateCache 相同，记录原有的标签被替换为 tags
+func (g *Group) populateCacheWithTags(key string, value ByteView, tags []string) {
+	// 不能缓存的值（超过 maxValueSize）同样存在，先加入布隆过滤器
+	if f := g.bloomFilter(); f != nil {
+		f.Add(key)
+	}
+	value, ok := g.prepare(key, value)
+	if !ok {
+		g.mainCache.remove(key)
+		if g.hotCache != nil {
+			g.hotCache.remove(key)
+		}
+		return
+	}
+	n := g.mainCache.addWithTags(key, value, tags)
+	g.Stats.Evictions.Add(int64(n))
+	if g.evictionBurst > 0 && n > g.evictionBurst {
+		g.Stats.EvictionBursts.Add(1)
+		g.logger.Printf("[GeeCache] adding %s evicted %d entries, cache may be undersized", key, n)
+	}
+}
+
+// 把从远程节点获取的值添加到 hotCache 中，未启用时不做任何事
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hotCache != nil {
+		g.addTo(g.hotCache, key, value)
+	}
+}
+
+// 返回 hotCache 中已经过期但还没有被淘汰的值，未启用 hotCache 时返回 false
+func (g *Group) hotStale(key string) (ByteView, bool) {
+	if g.hotCache == nil {
+		return ByteView{}, false
+	}
+	v, ok := g.hotCache.getStale(key)
+	if !ok {
+		return v, false
+	}
+	return g.decompress(key, v)
+}
+
+// 添加缓存到 c 中，返回淘汰的记录数。值不能缓存时删除 key 原有的记录
+func (g *Group) addTo(c *cache, key string, value ByteView) int {
+	value, ok := g.prepare(key, value)
+	if !ok {
+		c.remove(key)
+		return 0
+	}
+	return c.add(key, value)
+}
+
+// 将值转换为缓存中存放的形式：启用压缩时压缩，设置过期时间。超过 maxValueSize 或压缩失败时返回 false
+func (g *Group) prepare(key string, value ByteView) (ByteView, bool) {
+	if g.maxValueSize > 0 && value.Len() > g.maxValueSize {
+		return value, false
+	}
+	if g.compressor != nil {
+		b, err := g.compressor.Compress(value.b)
+		if err != nil {
+			g.logger.Printf("[GeeCache] Failed to compress %s %v", key, err)
+			return value, false
+		}
+		value.b = b
+	}
+	if value.e.IsZero() {
+		value.e = g.expireTime()
+	}
+	return value, true
+}
+
+// 计算新记录的过期时间，未设置 TTL 时返回零值
+func (g *Group) expireTime() time.Time {
+	if g.ttl <= 0 {
+		return time.Time{}
+	}
+	ttl := g.ttl
+	if g.ttlJitter > 0 {
+		// 在 [-ttlJitter, ttlJitter) 范围内均匀分布
+		ttl += time.Duration(float64(ttl) * g.ttlJitter * (2*rand.Float64() - 1))
+	}
+	return time.Now().Add(ttl)
 }
 
 // 使用实现了 PeerGetter 接口的 httpGetter 从访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// PeerGetter 实现了 ContextPeerGetter 时，ctx 取消会中止请求
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	// 使用 protobuf 编码报文，提高效率
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	var err error
+	stale, hasStale := g.hotStale(key)
+	if cp, ok := peer.(ConditionalPeerGetter); ok && hasStale {
+		// hotCache 中有过期的旧值时发出条件请求，值没有变化时继续使用旧值，由调用方重新设置过期时间
+		var modified bool
+		if modified, err = cp.GetIfModified(ctx, req, stale.b, res); err == nil && !modified {
+			g.Stats.PeerNotModified.Add(1)
+			return ByteView{b: stale.b, ct: stale.ct}, nil
+		}
+	} else if cp, ok := peer.(ContextPeerGetter); ok {
+		err = cp.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	// 节点没有该 key，与值为空区分开，由调用方回退到本地数据源
+	if res.NotFound {
+		return ByteView{}, fmt.Errorf("peer %s: %w", peerURL(peer), ErrNotFound)
+	}
+	return ByteView{b: res.Value, ct: res.ContentType}, nil
 }
@@ -1,10 +1,28 @@
 package cache
 
 import (
+	"cache/arc"
+	"cache/clock"
+	"cache/fifo"
+	pb "cache/geecachepb"
+	"cache/lru"
+	"cache/random"
+	"cache/singleflight"
+	"cache/twoqueue"
+	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"log"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode"
 )
 
 var db = map[string]string{
@@ -65,3 +83,1670 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestCallbacks(t *testing.T) {
+	loaded := make(map[string]string)
+	evicted := make([]string, 0)
+	var gee *Group
+	gee = NewGroup("callbacks", int64(len("k1v1k2v2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v" + key[1:]), nil
+		}),
+		WithOnLoad(func(key string, source string) { loaded[key] = source }),
+		WithOnEvict(func(key string) {
+			evicted = append(evicted, key)
+			// 回调中再次访问缓存不会死锁
+			gee.mainCache.get(key)
+		}))
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		if _, err := gee.Get(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(loaded) != 3 || loaded["k1"] != SourceLocal {
+		t.Fatalf("expect 3 local loads, but %v got", loaded)
+	}
+	if !reflect.DeepEqual(evicted, []string{"k1"}) {
+		t.Fatalf("expect k1 evicted, but %v got", evicted)
+	}
+}
+
+// fakeStore 同时实现了 Getter 和 WriteThrough 接口
+type fakeStore struct {
+	data   map[string]string
+	putErr error
+	ops    []string
+	// 写入数据源时调用，模拟并发的写入
+	onPut func(key string)
+}
+
+func (s *fakeStore) Get(key string) ([]byte, error) {
+	s.ops = append(s.ops, "get "+key)
+	if v, ok := s.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%s not exist", key)
+}
+
+func (s *fakeStore) Put(key string, value []byte) error {
+	s.ops = append(s.ops, "put "+key)
+	if s.onPut != nil {
+		s.onPut(key)
+	}
+	if s.putErr != nil {
+		return s.putErr
+	}
+	s.data[key] = string(value)
+	return nil
+}
+
+func TestSetWriteThrough(t *testing.T) {
+	store := &fakeStore{data: make(map[string]string)}
+	gee := NewGroup("writethrough", 2<<10, store)
+
+	if err := gee.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if store.data["Tom"] != "630" {
+		t.Fatal("value not written to store")
+	}
+	// 写入缓存之后再读取不会访问数据源
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect 630, but %v got", view)
+	}
+	if !reflect.DeepEqual(store.ops, []string{"put Tom"}) {
+		t.Fatalf("unexpected store ops %v", store.ops)
+	}
+
+	store.putErr = fmt.Errorf("store unavailable")
+	if err := gee.Set("Jack", []byte("589")); err == nil {
+		t.Fatal("expect error when put fails")
+	}
+	if _, ok := gee.mainCache.get("Jack"); ok {
+		t.Fatal("cache should not be updated when put fails")
+	}
+}
+
+func TestFallbackGetters(t *testing.T) {
+	primary := GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("primary down")
+	})
+	fallback := GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+	gee := NewGroup("fallback", 2<<10, primary, WithFallbackGetters(fallback))
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("expect 630 from fallback, but %v, %v got", view, err)
+	}
+	if _, ok := gee.mainCache.get("Tom"); !ok {
+		t.Fatal("fallback value should be cached")
+	}
+	if _, err := gee.Get("unknown"); err == nil || err.Error() != "unknown not exist" {
+		t.Fatalf("expect the last getter's error, but %v got", err)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	loads := 0
+	gee := NewGroup("bloom", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithBloomFilter(1<<10, 3))
+
+	// 重建之前不参与判断
+	if _, err := gee.Get("unknown"); err == nil || loads != 1 {
+		t.Fatalf("expect load before rebuild, but %d loads", loads)
+	}
+
+	keys := make([]string, 0, len(db))
+	for k := range db {
+		keys = append(keys, k)
+	}
+	gee.RebuildBloomFilter(keys)
+
+	// 不能有假阴性
+	for k, v := range db {
+		if view, err := gee.Get(k); err != nil || view.String() != v {
+			t.Fatalf("failed to get value of %s", k)
+		}
+	}
+	loads = 0
+	if _, err := gee.Get("unknown"); err != ErrNotFound || loads != 0 {
+		t.Fatalf("expect ErrNotFound without load, but %v and %d loads got", err, loads)
+	}
+
+	// Set 的 key 会加入过滤器
+	if err := gee.Set("Bob", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if !gee.bloomFilter().MayContain("Bob") {
+		t.Fatal("expect Bob added to bloom filter")
+	}
+	// 其他节点推送的值同样加入过滤器
+	if err := gee.fill("Alice", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if !gee.bloomFilter().MayContain("Alice") {
+		t.Fatal("expect pushed Alice added to bloom filter")
+	}
+}
+
+func TestOriginRateLimit(t *testing.T) {
+	loads := 0
+	gee := NewGroup("ratelimit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithOriginRateLimit(0.001, 2))
+
+	limited := 0
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		if _, err := gee.Get(k); err == ErrRateLimited {
+			limited++
+		}
+	}
+	if loads != 2 || limited != 3 {
+		t.Fatalf("expect 2 loads and 3 limited, but %d and %d got", loads, limited)
+	}
+	// 已缓存的 key 不受限制
+	if _, err := gee.Get("k1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	var mu sync.Mutex
+	loads := 0
+	gee := NewGroup("warm", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads++
+			mu.Unlock()
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	if err := gee.Warm(context.Background(), []string{"Tom", "Jack", "Sam"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	for k := range db {
+		if _, ok := gee.mainCache.get(k); !ok {
+			t.Fatalf("expect %s warmed", k)
+		}
+	}
+	if loads != 3 {
+		t.Fatalf("expect 3 loads, but %d got", loads)
+	}
+
+	if err := gee.Warm(context.Background(), []string{"Tom", "unknown"}, 2); err == nil {
+		t.Fatal("expect error for unknown key")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gee.Warm(ctx, []string{"Bob"}, 1); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, but %v got", err)
+	}
+}
+
+func TestListAndRemoveGroups(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	g := NewGroup("list-b", 2<<10, getter)
+	NewGroup("list-a", 2<<10, getter)
+	g.Get("Tom")
+
+	names := ListGroups()
+	idx := sort.SearchStrings(names, "list-a")
+	if !sort.StringsAreSorted(names) || idx+1 >= len(names) || names[idx] != "list-a" || names[idx+1] != "list-b" {
+		t.Fatalf("expect sorted names containing list-a and list-b, but %v got", names)
+	}
+
+	if !RemoveGroup("list-b") || GetGroup("list-b") != nil {
+		t.Fatal("remove list-b failed")
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatal("expect cache cleared after remove")
+	}
+	if RemoveGroup("list-b") {
+		t.Fatal("expect false when removing a missing group")
+	}
+	RemoveGroup("list-a")
+}
+
+func TestNewGroupDuplicate(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	g := NewGroup("duplicate", 2<<10, getter)
+	defer RemoveGroup("duplicate")
+
+	if dup := NewGroup("duplicate", 2<<10, getter); dup != g || GetGroup("duplicate") != g {
+		t.Fatal("expect the existing group returned")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expect panic on duplicate registration")
+		}
+	}()
+	NewGroup("duplicate", 2<<10, getter, WithPanicOnDuplicate())
+}
+
+// 各淘汰算法都实现了 Policy 接口
+var (
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*twoqueue.Cache)(nil)
+	_ Policy = (*arc.Cache)(nil)
+	_ Policy = (*clock.Cache)(nil)
+	_ Policy = (*fifo.Cache)(nil)
+	_ Policy = (*random.Cache)(nil)
+)
+
+func TestWithPolicy(t *testing.T) {
+	gee := NewGroup("twoqueue", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return twoqueue.New(maxBytes, onEvicted)
+	}))
+	defer RemoveGroup("twoqueue")
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatal("failed to get value of Tom")
+	}
+	if _, ok := gee.mainCache.lru.(*twoqueue.Cache); !ok {
+		t.Fatalf("expect *twoqueue.Cache, but %T got", gee.mainCache.lru)
+	}
+}
+
+func TestSize(t *testing.T) {
+	gee := NewGroup("size", int64(len("k1k1k2k2")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("size")
+
+	if bytes, entries := gee.Size(); bytes != 0 || entries != 0 {
+		t.Fatalf("expect empty cache, but %d bytes and %d entries got", bytes, entries)
+	}
+	gee.Get("k1")
+	gee.Get("k2")
+	if bytes, entries := gee.Size(); bytes != 8 || entries != 2 {
+		t.Fatalf("expect 8 bytes and 2 entries, but %d and %d got", bytes, entries)
+	}
+	// 淘汰之后大小不超过容量
+	gee.Get("k333")
+	if bytes, entries := gee.Size(); bytes != 8 || entries != 1 {
+		t.Fatalf("expect 8 bytes and 1 entry, but %d and %d got", bytes, entries)
+	}
+	if gee.Capacity() != 8 {
+		t.Fatalf("expect capacity 8, but %d got", gee.Capacity())
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	gee := NewGroup("maxvaluesize", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "big" {
+				return make([]byte, 100), nil
+			}
+			return []byte(key), nil
+		}), WithMaxValueSize(10))
+	defer RemoveGroup("maxvaluesize")
+
+	gee.Get("Tom")
+	if view, err := gee.Get("big"); err != nil || view.Len() != 100 {
+		t.Fatal("expect oversized value returned to the caller")
+	}
+	if _, ok := gee.mainCache.get("big"); ok {
+		t.Fatal("expect oversized value not cached")
+	}
+	if _, ok := gee.mainCache.get("Tom"); !ok {
+		t.Fatal("expect Tom to survive")
+	}
+}
+
+func TestMaxValueSizeDropsOldValue(t *testing.T) {
+	store := &fakeStore{data: make(map[string]string)}
+	gee := NewGroup("maxvaluesizeold", 2<<10, store, WithMaxValueSize(10))
+	defer RemoveGroup("maxvaluesizeold")
+
+	if err := gee.Set("k", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("x", 100)
+	if err := gee.Set("k", []byte(big)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gee.mainCache.get("k"); ok {
+		t.Fatal("expect the old value dropped from the cache")
+	}
+	if view, err := gee.Get("k"); err != nil || view.String() != big {
+		t.Fatalf("expect the new value from the store, but %q got", view.String())
+	}
+}
+
+func TestOversizedValueWithPolicy(t *testing.T) {
+	gee := NewGroup("oversizedpolicy", 64, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return twoqueue.New(maxBytes, onEvicted)
+	}))
+	defer RemoveGroup("oversizedpolicy")
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		gee.Get(k)
+	}
+	if err := gee.Set("big", make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, entries := gee.Size(); entries != 3 {
+		t.Fatalf("expect 3 entries to survive, but %d got", entries)
+	}
+	if _, ok := gee.mainCache.get("big"); ok {
+		t.Fatal("expect oversized value not cached")
+	}
+}
+
+func TestEvictionBurst(t *testing.T) {
+	logger := &bufLogger{}
+	gee := NewGroup("evictionburst", int64(len("k1k1k2k2k3k3k4k4")), GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithEvictionBurstThreshold(2), WithGroupLogger(logger))
+	defer RemoveGroup("evictionburst")
+
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		gee.Get(k)
+	}
+	if gee.Stats.Evictions.Get() != 0 {
+		t.Fatalf("expect no evictions, but %d got", gee.Stats.Evictions.Get())
+	}
+
+	// 一次添加淘汰 3 条记录
+	gee.Get("k55555")
+	if gee.Stats.Evictions.Get() != 3 || gee.Stats.EvictionBursts.Get() != 1 {
+		t.Fatalf("expect 3 evictions in 1 burst, but %s and %s got",
+			gee.Stats.Evictions.String(), gee.Stats.EvictionBursts.String())
+	}
+	if len(logger.lines) != 1 {
+		t.Fatalf("expect one warning, but %v got", logger.lines)
+	}
+}
+
+// fakePeer 总是返回 "peer value"
+type fakePeer struct{}
+
+func (fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value = []byte("peer value")
+	return nil
+}
+
+func (fakePeer) String() string { return "http://fake-peer/_cache/" }
+
+// fakePicker 将 remote 开头的 key 路由到 fakePeer
+type fakePicker struct{}
+
+func (fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return fakePeer{}, true
+	}
+	return nil, false
+}
+
+func TestGetWithInfo(t *testing.T) {
+	gee := NewGroup("getwithinfo", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("getwithinfo")
+	gee.RegisterPeers(fakePicker{})
+
+	if _, info, err := gee.GetWithInfo("Tom"); err != nil || info.Source != SourceLocal {
+		t.Fatalf("expect local load, but %+v, %v got", info, err)
+	}
+	if _, info, err := gee.GetWithInfo("Tom"); err != nil || info.Source != SourceHit || info.LoadLatency != 0 {
+		t.Fatalf("expect hit, but %+v, %v got", info, err)
+	}
+	view, info, err := gee.GetWithInfo("remote-Tom")
+	if err != nil || view.String() != "peer value" || info.Source != SourcePeer || info.PeerURL != "http://fake-peer/_cache/" {
+		t.Fatalf("expect peer load, but %+v, %v got", info, err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	loads := 0
+	gee := NewGroup("ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithTTL(20*time.Millisecond))
+	defer RemoveGroup("ttl")
+
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if loads != 1 {
+		t.Fatalf("expect 1 load before expiry, but %d got", loads)
+	}
+	time.Sleep(30 * time.Millisecond)
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("expect reload after expiry, but %d loads got", loads)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	loads := 0
+	gee := NewGroup("maxage", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithMaxAge(30*time.Millisecond), WithTTL(time.Hour))
+	defer RemoveGroup("maxage")
+
+	gee.Get("Tom")
+	gee.Set("Jack", []byte("Jack"))
+	// 剩余时间不超过 maxAge
+	if _, ttl, err := gee.GetWithTTL("Tom"); err != nil || ttl <= 0 || ttl > 30*time.Millisecond {
+		t.Fatalf("expect ttl bounded by max age, but %v, %v got", ttl, err)
+	}
+	// Touch 不能延长 maxAge
+	if !gee.Touch("Tom", time.Hour) {
+		t.Fatal("expect touch of cached key to return true")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := gee.GetIfPresent("Jack"); ok {
+		t.Fatal("expect Jack past max age to miss")
+	}
+	if keys := gee.Keys(0); len(keys) != 0 {
+		t.Fatalf("expect no live keys, but %v got", keys)
+	}
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("expect Tom reloaded past max age, but %d loads got", loads)
+	}
+	// 重新加载后重新计时
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("expect reloaded Tom cached, but %d loads got", loads)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	const ttl = time.Hour
+	gee := NewGroup("ttljitter", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(ttl), WithTTLJitter(0.2))
+	defer RemoveGroup("ttljitter")
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		gee.Get(strconv.Itoa(i))
+	}
+	end := time.Now()
+
+	// 把抖动窗口 [0.8h, 1.2h) 均分成 10 段，每段都应该有记录过期
+	buckets := make([]int, 10)
+	for i := 0; i < 1000; i++ {
+		v, ok := gee.mainCache.get(strconv.Itoa(i))
+		if !ok {
+			t.Fatalf("key %d missing", i)
+		}
+		if v.Expire().Before(start.Add(ttl*8/10)) || v.Expire().After(end.Add(ttl*12/10)) {
+			t.Fatalf("expire %v out of jitter window", v.Expire().Sub(start))
+		}
+		offset := v.Expire().Sub(start) - ttl*8/10
+		idx := int(offset * 10 / (ttl * 4 / 10))
+		if idx > 9 {
+			idx = 9
+		}
+		buckets[idx]++
+	}
+	for i, n := range buckets {
+		if n < 50 {
+			t.Fatalf("expect expiry spread across jitter window, but bucket %d has %d: %v", i, n, buckets)
+		}
+	}
+}
+
+func TestMaxConcurrentLoads(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	block := make(chan struct{})
+	gee := NewGroup("maxloads", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			if strings.HasPrefix(key, "block") {
+				<-block
+			} else {
+				time.Sleep(5 * time.Millisecond)
+			}
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return []byte(key), nil
+		}), WithMaxConcurrentLoads(3))
+	defer RemoveGroup("maxloads")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gee.Get(strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	if maxRunning != 3 {
+		t.Fatalf("expect at most 3 concurrent loads, but %d got", maxRunning)
+	}
+
+	// 名额用完时，ctx 取消后停止等待
+	for i := 0; i < 3; i++ {
+		go gee.Get("block" + strconv.Itoa(i))
+	}
+	defer close(block)
+	for {
+		mu.Lock()
+		n := running
+		mu.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "waiting"); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but %v got", err)
+	}
+}
+
+func TestLoaderStats(t *testing.T) {
+	release := make(chan struct{})
+	gee := NewGroup("loaderstats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			<-release
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("loaderstats")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gee.Get("Tom")
+		}()
+	}
+	for gee.LoaderStats().Coalesced < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := gee.LoaderStats(); s.InFlight != 1 {
+		t.Fatalf("expect 1 load in flight, but %+v got", s)
+	}
+	close(release)
+	wg.Wait()
+	if s := gee.LoaderStats(); s.InFlight != 0 || s.Coalesced != 3 {
+		t.Fatalf("expect 3 coalesced loads, but %+v got", s)
+	}
+}
+
+func TestKeyValidator(t *testing.T) {
+	loads := 0
+	gee := NewGroup("keyvalidator", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithKeyValidator(KeyLimits(8, nil)))
+	defer RemoveGroup("keyvalidator")
+
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatalf("expect valid key accepted, but %v got", err)
+	}
+	for _, key := range []string{"toolongkey", "Tom\nJack", "\xff"} {
+		if _, err := gee.Get(key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("expect ErrInvalidKey for %q, but %v got", key, err)
+		}
+		if err := gee.Set(key, []byte("v")); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("expect Set of %q rejected, but %v got", key, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect invalid keys rejected before load, but %d loads got", loads)
+	}
+
+	// 只允许字母和数字
+	alnum := KeyLimits(0, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+	if alnum("Tom630") != nil || alnum("Tom-630") == nil {
+		t.Fatal("expect only letters and digits allowed")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	loads := 0
+	gee := NewGroup("touch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}), WithTTL(30*time.Millisecond))
+	defer RemoveGroup("touch")
+
+	if gee.Touch("Tom", time.Minute) {
+		t.Fatal("expect touch of missing key to return false")
+	}
+	gee.Get("Tom")
+	if !gee.Touch("Tom", time.Minute) {
+		t.Fatal("expect touch of cached key to return true")
+	}
+	// 超过原来的过期时间之后仍然命中
+	time.Sleep(40 * time.Millisecond)
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" || loads != 1 {
+		t.Fatalf("expect touched entry to survive, but %s, %v, %d loads got", v, err, loads)
+	}
+}
+
+func TestOnEvictReason(t *testing.T) {
+	var mu sync.Mutex
+	var reasons []string
+	gee := NewGroup("evictreason", 20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(20*time.Millisecond), WithOnEvictReason(func(key string, reason lru.Reason) {
+		mu.Lock()
+		reasons = append(reasons, key+":"+reason.String())
+		mu.Unlock()
+	}))
+
+	gee.Get("k1")
+	gee.Set("k1", []byte("k1"))
+	gee.Get("k2")
+	time.Sleep(30 * time.Millisecond)
+	// k1 和 k2 都已过期，k2 重新加载
+	gee.Get("k2")
+	// 超过容量，淘汰最久未使用的 k1
+	gee.Get("k3333333")
+	RemoveGroup("evictreason")
+
+	expect := []string{"k1:replaced", "k2:expired", "k1:capacity", "k3333333:cleared", "k2:cleared"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, but %v got", expect, reasons)
+	}
+}
+
+func TestNilValue(t *testing.T) {
+	loads := 0
+	nilGetter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return nil, nil
+	})
+
+	// 默认缓存空值
+	gee := NewGroup("nilvalue", 2<<10, nilGetter)
+	defer RemoveGroup("nilvalue")
+	for i := 0; i < 2; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.Len() != 0 {
+			t.Fatalf("expect empty value, but %q, %v got", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect empty value cached, but %d loads got", loads)
+	}
+
+	// 视为不存在，不缓存
+	loads = 0
+	gee = NewGroup("nilnotfound", 2<<10, nilGetter, WithNilAsNotFound(true))
+	defer RemoveGroup("nilnotfound")
+	for i := 0; i < 2; i++ {
+		if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, but %v got", err)
+		}
+	}
+	if _, entries := gee.Size(); loads != 2 || entries != 0 {
+		t.Fatalf("expect nil not cached, but %d loads and %d entries got", loads, entries)
+	}
+}
+
+func TestGetIfPresent(t *testing.T) {
+	loads := 0
+	gee := NewGroup("getifpresent", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("getifpresent")
+	gee.RegisterPeers(fakePicker{})
+
+	if _, ok := gee.GetIfPresent("Tom"); ok {
+		t.Fatal("expect miss before load")
+	}
+	if _, ok := gee.GetIfPresent("remote-Tom"); ok {
+		t.Fatal("expect miss without asking peers")
+	}
+	gee.Set("Tom", []byte("630"))
+	if v, ok := gee.GetIfPresent("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("expect hit 630, but %s, %v got", v, ok)
+	}
+	if loads != 0 {
+		t.Fatalf("expect no getter calls, but %d got", loads)
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	gee := NewGroup("getbytes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("630"), nil
+		}))
+	defer RemoveGroup("getbytes")
+
+	b, err := gee.GetBytes("Tom")
+	if err != nil || string(b) != "630" {
+		t.Fatalf("expect 630, but %s, %v got", b, err)
+	}
+	b[0] = 'X'
+	if b, _ := gee.GetBytes("Tom"); string(b) != "630" {
+		t.Fatalf("expect cached value unchanged, but %s got", b)
+	}
+}
+
+func TestGetMultiSharesLoads(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	release := make(chan struct{})
+	gee := NewGroup("getmulti", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads[key]++
+			mu.Unlock()
+			<-release
+			if key == "unknown" {
+				return nil, ErrNotFound
+			}
+			return []byte(db[key]), nil
+		}))
+	defer RemoveGroup("getmulti")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+			t.Errorf("expect 630, but %s, %v got", v, err)
+		}
+	}()
+	var values map[string]ByteView
+	var err error
+	go func() {
+		defer wg.Done()
+		values, err = gee.GetMulti([]string{"Tom", "Jack", "Tom", "unknown"})
+	}()
+	// 等待两条路径都在加载 Tom
+	for gee.LoaderStats().Coalesced < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if loads["Tom"] != 1 || loads["Jack"] != 1 {
+		t.Fatalf("expect each key loaded once, but %v got", loads)
+	}
+	if len(values) != 2 || values["Tom"].String() != "630" || values["Jack"].String() != "589" {
+		t.Fatalf("expect Tom and Jack, but %v got", values)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound for unknown, but %v got", err)
+	}
+}
+
+func TestLoaderShards(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	loads := 0
+	gee := NewGroup("loadershards", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads++
+			mu.Unlock()
+			<-release
+			return []byte(key), nil
+		}), WithLoaderShards(16))
+	defer RemoveGroup("loadershards")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gee.Get("Tom")
+		}()
+	}
+	for gee.LoaderStats().Coalesced < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("expect sharded loader to dedup, but %d loads got", loads)
+	}
+}
+
+func TestHotCacheBytes(t *testing.T) {
+	gee := NewGroup("hotcache", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCacheBytes(40))
+	defer RemoveGroup("hotcache")
+	gee.RegisterPeers(fakePicker{})
+
+	gee.Get("Tom")
+	// 每条记录 len("remote-0") + len("peer value") = 18 字节，hotCache 只能放下 2 条
+	for i := 0; i < 5; i++ {
+		if v, err := gee.Get("remote-" + strconv.Itoa(i)); err != nil || v.String() != "peer value" {
+			t.Fatalf("expect peer value, but %s, %v got", v, err)
+		}
+	}
+	if bytes, entries := gee.HotSize(); bytes > 40 || entries != 2 {
+		t.Fatalf("expect hot cache within 40 bytes, but %d bytes, %d entries got", bytes, entries)
+	}
+	// 远程 key 不会挤占 mainCache
+	if _, entries := gee.Size(); entries != 1 {
+		t.Fatalf("expect 1 entry in main cache, but %d got", entries)
+	}
+	if _, ok := gee.GetIfPresent("Tom"); !ok {
+		t.Fatal("expect Tom to survive hot cache evictions")
+	}
+
+	gee.Get("remote-4")
+	gee.Get("Tom")
+	if gee.Stats.HotHits.Get() != 1 || gee.Stats.MainHits.Get() != 1 || gee.Stats.Hits.Get() != 2 {
+		t.Fatalf("expect 1 hot hit and 1 main hit, but %d, %d got", gee.Stats.HotHits.Get(), gee.Stats.MainHits.Get())
+	}
+	if _, info, _ := gee.GetWithInfo("remote-0"); info.Source != SourcePeer {
+		t.Fatalf("expect evicted hot key to be fetched again, but %+v got", info)
+	}
+}
+
+// countingLoader 记录 Do 的调用次数
+type countingLoader struct {
+	flightGroup
+	calls int64
+}
+
+func (l *countingLoader) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	atomic.AddInt64(&l.calls, 1)
+	return l.flightGroup.Do(key, fn)
+}
+
+// 命中缓存时不能进入 loader
+func BenchmarkGetHit(b *testing.B) {
+	gee := NewGroup("benchgethit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("benchgethit")
+	gee.Get("Tom")
+	loader := &countingLoader{flightGroup: gee.loader}
+	gee.loader = loader
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			if _, err := gee.GetContext(ctx, "Tom"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+	if calls := atomic.LoadInt64(&loader.calls); calls != 0 {
+		b.Fatalf("expect no loader calls on hits, but %d got", calls)
+	}
+	if stats := gee.LoaderStats(); stats.InFlight != 0 || stats.Coalesced != 0 {
+		b.Fatalf("expect idle loader, but %+v got", stats)
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	gee := NewGroup("getwithttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(time.Second))
+	defer RemoveGroup("getwithttl")
+
+	// 加载时返回的剩余时间与缓存中的值一致
+	_, first, err := gee.GetWithTTL("Tom")
+	if err != nil || first <= 900*time.Millisecond || first > time.Second {
+		t.Fatalf("expect ttl close to 1s, but %v, %v got", first, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, second, _ := gee.GetWithTTL("Tom")
+	if d := first - second; d < 20*time.Millisecond || d > 200*time.Millisecond {
+		t.Fatalf("expect ttl to decrease by about 20ms, but %v -> %v", first, second)
+	}
+
+	forever := NewGroup("getwithttl-forever", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("getwithttl-forever")
+	if _, ttl, _ := forever.GetWithTTL("Tom"); ttl != lru.NoTTL {
+		t.Fatalf("expect NoTTL without WithTTL, but %v got", ttl)
+	}
+}
+
+func TestStaleOnSlow(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		version = 1
+		release chan struct{}
+	)
+	gee := NewGroup("staleonslow", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			v, wait := version, release
+			mu.Unlock()
+			if wait != nil {
+				<-wait
+			}
+			return []byte(key + strconv.Itoa(v)), nil
+		}), WithTTL(10*time.Millisecond), WithStaleOnSlow(20*time.Millisecond))
+	defer RemoveGroup("staleonslow")
+
+	gee.Get("Tom")
+	time.Sleep(15 * time.Millisecond)
+	// 数据源很快时照常返回新值
+	mu.Lock()
+	version = 2
+	mu.Unlock()
+	if v, info, err := gee.GetWithInfo("Tom"); err != nil || v.String() != "Tom2" || info.Source != SourceLocal {
+		t.Fatalf("expect fresh Tom2, but %s, %+v, %v got", v, info, err)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	mu.Lock()
+	version, release = 3, make(chan struct{})
+	mu.Unlock()
+	v, info, err := gee.GetWithInfo("Tom")
+	if err != nil || v.String() != "Tom2" || info.Source != SourceStale {
+		t.Fatalf("expect stale Tom2 on slow origin, but %s, %+v, %v got", v, info, err)
+	}
+	if info.LoadLatency < 20*time.Millisecond {
+		t.Fatalf("expect to wait for the deadline, but %v got", info.LoadLatency)
+	}
+
+	// 后台加载完成后更新缓存
+	mu.Lock()
+	close(release)
+	release = nil
+	mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for {
+		// 新值可能在检查之前就已经过期
+		v, ok := gee.GetIfPresent("Tom")
+		if !ok {
+			v, ok = gee.mainCache.getStale("Tom")
+		}
+		if ok && v.String() == "Tom3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect background load to refresh Tom")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	gee := NewGroup("keys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("keys")
+	if keys := gee.Keys(10); len(keys) != 0 {
+		t.Fatalf("expect no keys, but %v got", keys)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		gee.Get(key)
+	}
+	gee.Get("Tom")
+	// 过期的 key 不返回
+	gee.Get("Lily")
+	gee.Touch("Lily", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if keys := gee.Keys(0); !reflect.DeepEqual(keys, []string{"Tom", "Sam", "Jack"}) {
+		t.Fatalf("expect live keys in MRU order, but %v got", keys)
+	}
+	if keys := gee.Keys(2); !reflect.DeepEqual(keys, []string{"Tom", "Sam"}) {
+		t.Fatalf("expect 2 keys, but %v got", keys)
+	}
+	// Keys 不改变顺序
+	gee.Keys(1)
+	if keys := gee.Keys(0); !reflect.DeepEqual(keys, []string{"Tom", "Sam", "Jack"}) {
+		t.Fatalf("expect order unchanged, but %v got", keys)
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	gee := NewGroup("setifversion", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("0"), nil
+		}))
+	defer RemoveGroup("setifversion")
+
+	// 不在缓存中时版本号为 0
+	if err := gee.SetIfVersion("Tom", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	v, version, err := gee.GetWithVersion("Tom")
+	if err != nil || v.String() != "1" || version == 0 {
+		t.Fatalf("expect Tom=1 with a version, but %s, %d, %v got", v, version, err)
+	}
+
+	// 两个写入方读到相同的版本号，只有先写入的成功
+	if err := gee.SetIfVersion("Tom", []byte("2"), version); err != nil {
+		t.Fatalf("expect first CAS to succeed, but %v got", err)
+	}
+	if err := gee.SetIfVersion("Tom", []byte("3"), version); err != ErrVersionMismatch {
+		t.Fatalf("expect ErrVersionMismatch, but %v got", err)
+	}
+	v, next, _ := gee.GetWithVersion("Tom")
+	if v.String() != "2" || next <= version {
+		t.Fatalf("expect Tom=2 with a newer version, but %s, %d got", v, next)
+	}
+
+	// 刚加载的值也带有版本号，Set 会更新版本号
+	_, loaded, _ := gee.GetWithVersion("Jack")
+	if loaded <= next {
+		t.Fatalf("expect loaded value to get a newer version, but %d got", loaded)
+	}
+	gee.Set("Jack", []byte("4"))
+	if err := gee.SetIfVersion("Jack", []byte("5"), loaded); err != ErrVersionMismatch {
+		t.Fatalf("expect ErrVersionMismatch after Set, but %v got", err)
+	}
+}
+
+func TestSetIfVersionChangedDuringPut(t *testing.T) {
+	store := &fakeStore{data: make(map[string]string)}
+	gee := NewGroup("setifversion-put", 2<<10, store)
+	defer RemoveGroup("setifversion-put")
+
+	// 写入数据源期间缓存被并发的加载修改，数据源已写入成功，不能再报告冲突
+	store.onPut = func(key string) {
+		gee.mainCache.add(key, ByteView{b: []byte("stale")})
+	}
+	if err := gee.SetIfVersion("Tom", []byte("630"), 0); err != nil {
+		t.Fatalf("expect success after the store was written, but %v got", err)
+	}
+	if v, _ := gee.GetIfPresent("Tom"); v.String() != "630" || store.data["Tom"] != "630" {
+		t.Fatalf("expect cache and store to agree on 630, but %s, %s got", v, store.data["Tom"])
+	}
+}
+
+func TestAsyncEvictCallbacks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		evicted []string
+	)
+	block := make(chan struct{})
+	gee := NewGroup("asyncevict", 6, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v"), nil
+		}), WithAsyncEvictCallbacks(16), WithOnEvict(func(key string) {
+		<-block
+		mu.Lock()
+		evicted = append(evicted, key)
+		mu.Unlock()
+	}))
+
+	// 回调被阻塞时写入方不受影响
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		gee.Get(key)
+	}
+	close(block)
+	RemoveGroup("asyncevict")
+
+	// 容量只能放下 2 条记录，RemoveGroup 之前缓冲的回调全部调用完
+	if expect := []string{"k1", "k2", "k3"}; !reflect.DeepEqual(evicted, expect) {
+		t.Fatalf("expect evictions %v in order, but %v got", expect, evicted)
+	}
+}
+
+// 每次写入都淘汰一条记录，淘汰回调做少量计算
+func benchmarkEvictCallbacks(b *testing.B, name string, opts ...GroupOption) {
+	var sink uint64
+	opts = append(opts, WithOnEvict(func(key string) {
+		h := uint64(len(key))
+		for i := 0; i < 2000; i++ {
+			h = h*31 + uint64(i)
+		}
+		atomic.AddUint64(&sink, h)
+	}))
+	gee := NewGroup(name, 64, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), opts...)
+	defer RemoveGroup(name)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gee.Set(keys[i%len(keys)], []byte("v"))
+	}
+}
+
+func BenchmarkEvictCallbacksInline(b *testing.B) {
+	benchmarkEvictCallbacks(b, "bench-evict-inline")
+}
+
+func BenchmarkEvictCallbacksAsync(b *testing.B) {
+	benchmarkEvictCallbacks(b, "bench-evict-async", WithAsyncEvictCallbacks(1024))
+}
+
+// 使用 -race 运行，检查 Len、Size 与写入和淘汰并发时没有数据竞争且结果一致
+func TestLenConcurrent(t *testing.T) {
+	gee := NewGroup("lenconcurrent", 64, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("lenconcurrent")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := "key" + strconv.Itoa(i*1000+n%100)
+				gee.Get(key)
+				gee.Set(key, []byte("v"))
+			}
+		}(i)
+	}
+	for i := 0; i < 1000; i++ {
+		// 每条记录至少 len("key0") + 1 字节，64 字节最多放下 12 条
+		if n := gee.Len(); n < 0 || n > 12 {
+			t.Fatalf("expect at most 12 entries, but %d got", n)
+		}
+		if bytes, entries := gee.Size(); bytes > 64 || (entries == 0) != (bytes == 0) {
+			t.Fatalf("expect consistent size, but %d bytes, %d entries got", bytes, entries)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestLoadOrStore(t *testing.T) {
+	loads := 0
+	gee := NewGroup("loadorstore", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("from getter"), nil
+		}))
+	defer RemoveGroup("loadorstore")
+
+	if v, loaded := gee.LoadOrStore("Tom", []byte("630")); loaded || v.String() != "630" {
+		t.Fatalf("expect 630 stored, but %s, %v got", v, loaded)
+	}
+	if v, loaded := gee.LoadOrStore("Tom", []byte("589")); !loaded || v.String() != "630" {
+		t.Fatalf("expect existing 630, but %s, %v got", v, loaded)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" || loads != 0 {
+		t.Fatalf("expect stored value without getter, but %s, %v, %d loads got", v, err, loads)
+	}
+
+	// 并发存入不同的值，只有一个胜出
+	const n = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners int
+		values  = make(map[string]bool)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, loaded := gee.LoadOrStore("Jack", []byte(strconv.Itoa(i)))
+			mu.Lock()
+			defer mu.Unlock()
+			if !loaded {
+				winners++
+			}
+			values[v.String()] = true
+		}(i)
+	}
+	wg.Wait()
+	if winners != 1 || len(values) != 1 {
+		t.Fatalf("expect exactly one winner and one value, but %d winners, %v got", winners, values)
+	}
+	if v, _ := gee.GetIfPresent("Jack"); !values[v.String()] {
+		t.Fatalf("expect cached value to be the winner, but %s got", v)
+	}
+	if loads != 0 {
+		t.Fatalf("expect no getter calls, but %d got", loads)
+	}
+}
+
+// 每次 Do 都合并到失败的加载
+type failingFlight struct {
+	singleflight.Group
+}
+
+func (f *failingFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return nil, fmt.Errorf("%s not exist", key)
+}
+
+func TestLoadOrStoreKeepsFailing(t *testing.T) {
+	gee := NewGroup("loadorstore-keepsfailing", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	defer RemoveGroup("loadorstore-keepsfailing")
+	gee.loader = &failingFlight{}
+
+	done := make(chan ByteView, 1)
+	go func() {
+		v, _ := gee.LoadOrStore("Tom", []byte("630"))
+		done <- v
+	}()
+	select {
+	case v := <-done:
+		if v.String() != "630" {
+			t.Fatalf("expect 630 stored, but %s got", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect LoadOrStore to return while loads keep failing")
+	}
+}
+
+func TestLoadOrStoreJoinedLoadFails(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	gee := NewGroup("loadorstore-fail", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			close(entered)
+			<-release
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	defer RemoveGroup("loadorstore-fail")
+
+	go gee.Get("Tom")
+	<-entered
+
+	// 合并到失败的加载后，仍然只有一个调用方写入
+	const n = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners int
+		values  = make(map[string]bool)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, loaded := gee.LoadOrStore("Tom", []byte(strconv.Itoa(i)))
+			mu.Lock()
+			defer mu.Unlock()
+			if !loaded {
+				winners++
+			}
+			values[v.String()] = true
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if winners != 1 || len(values) != 1 {
+		t.Fatalf("expect exactly one winner and one value, but %d winners, %v got", winners, values)
+	}
+	if v, _ := gee.GetIfPresent("Tom"); !values[v.String()] {
+		t.Fatalf("expect cached value to be the winner, but %s got", v)
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	release := make(chan struct{})
+	gee := NewGroup("hotkeys", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" {
+				<-release
+			}
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("hotkeys")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gee.Get("Tom")
+		}()
+	}
+	for gee.LoaderStats().Coalesced < 49 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	gee.Get("Jack")
+
+	top := gee.HotKeys(5)
+	if len(top) == 0 || top[0].Key != "Tom" || top[0].Coalesced != 49 {
+		t.Fatalf("expect Tom as the hottest key, but %v got", top)
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	var evicted []string
+	gee := NewGroup("cacheshards", 4<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithCacheShards(4), WithOnEvict(func(key string) {
+		evicted = append(evicted, key)
+	}))
+	defer RemoveGroup("cacheshards")
+
+	if len(gee.mainCache.shards) != 4 {
+		t.Fatalf("expect 4 shards, but %d got", len(gee.mainCache.shards))
+	}
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if v, err := gee.Get(key); err != nil || v.String() != key {
+			t.Fatalf("expect %s, but %s, %v got", key, v, err)
+		}
+	}
+	if len(gee.Keys(0)) != 100 || gee.Len() != 100 {
+		t.Fatalf("expect 100 keys, but %d, %d got", len(gee.Keys(0)), gee.Len())
+	}
+	if keys := gee.Keys(10); len(keys) != 10 {
+		t.Fatalf("expect 10 keys, but %d got", len(keys))
+	}
+	// 同一个 key 总是落在同一个分片，且每个分片都分到了 key
+	for i, s := range gee.mainCache.shards {
+		if _, n := s.size(); n == 0 {
+			t.Fatalf("expect keys on shard %d", i)
+		}
+		for _, key := range s.keys() {
+			if gee.mainCache.shard(key) != s {
+				t.Fatalf("expect %s on shard %d", key, i)
+			}
+		}
+	}
+
+	// 每个分片只占 cacheBytes 的四分之一，超过时在分片内淘汰
+	for i := 100; i < 1000; i++ {
+		gee.Get("key" + strconv.Itoa(i))
+	}
+	for i, s := range gee.mainCache.shards {
+		if bytes, _ := s.size(); bytes > (4<<10)/4 {
+			t.Fatalf("expect shard %d within %d bytes, but %d got", i, (4<<10)/4, bytes)
+		}
+	}
+	if len(evicted) == 0 {
+		t.Fatal("expect evictions reported from shards")
+	}
+
+	gee.mainCache.remove("key999")
+	if _, ok := gee.GetIfPresent("key999"); ok {
+		t.Fatal("expect key999 removed from its shard")
+	}
+	gee.mainCache.clear()
+	if gee.Len() != 0 {
+		t.Fatalf("expect all shards cleared, but %d got", gee.Len())
+	}
+}
+
+func TestCacheShardsUseShardHash(t *testing.T) {
+	var calls int32
+	gee := NewGroup("cacheshards-hash", 4<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithCacheShards(4), WithShardHash(func(data []byte) uint32 {
+		atomic.AddInt32(&calls, 1)
+		return crc32.ChecksumIEEE(data)
+	}))
+	defer RemoveGroup("cacheshards-hash")
+
+	before := atomic.LoadInt32(&calls)
+	gee.Get("Tom")
+	if atomic.LoadInt32(&calls) == before {
+		t.Fatal("expect cache shards to use the configured shard hash")
+	}
+}
+
+// 并发读取大量不同的 key，比较不同分片数的吞吐量（需要多核，如 -cpu 8）
+func BenchmarkGetShards(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			name := "benchshards-" + strconv.Itoa(n)
+			gee := NewGroup(name, 0, GetterFunc(
+				func(key string) ([]byte, error) {
+					return []byte(key), nil
+				}), WithCacheShards(n))
+			defer RemoveGroup(name)
+			for _, key := range keys {
+				gee.Get(key)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(p *testing.PB) {
+				for i := 0; p.Next(); i++ {
+					if _, err := gee.Get(keys[i%len(keys)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	var loads int32
+	gee := NewGroup("do", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("do")
+
+	var runs int32
+	release := make(chan struct{})
+	aggregate := func() (ByteView, error) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return NewByteView([]byte("sum=630")), nil
+	}
+	const callers = 10
+	results := make([]ByteView, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := gee.Do("report", aggregate)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = v
+		}(i)
+	}
+	for gee.LoaderStats().Coalesced < callers-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if runs != 1 {
+		t.Fatalf("expect fn to run once, but %d runs got", runs)
+	}
+	for _, v := range results {
+		if v.String() != "sum=630" {
+			t.Fatalf("expect shared result, but %s got", v)
+		}
+	}
+	if v, err := gee.Get("report"); err != nil || v.String() != "sum=630" || atomic.LoadInt32(&loads) != 0 {
+		t.Fatalf("expect result cached without the getter, but %s, %v, %d loads got", v, err, loads)
+	}
+
+	// 失败时不写入缓存
+	errFailed := errors.New("aggregate failed")
+	if _, err := gee.Do("broken", func() (ByteView, error) { return ByteView{}, errFailed }); err != errFailed {
+		t.Fatalf("expect fn error, but %v got", err)
+	}
+	if _, ok := gee.GetIfPresent("broken"); ok {
+		t.Fatal("expect failed result not cached")
+	}
+}
+
+// 记录选择节点和请求远程节点时使用的 key
+type keyRecorder struct {
+	picked    []string
+	requested []string
+}
+
+func (r *keyRecorder) PickPeer(key string) (PeerGetter, bool) {
+	r.picked = append(r.picked, key)
+	return r, strings.HasPrefix(key, "remote")
+}
+
+func (r *keyRecorder) Get(in *pb.Request, out *pb.Response) error {
+	r.requested = append(r.requested, in.GetKey())
+	out.Value = []byte("from peer")
+	return nil
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	var loads []string
+	gee := NewGroup("keynormalizer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads = append(loads, key)
+			return []byte(key), nil
+		}), WithKeyNormalizer(func(key string) string {
+		return strings.TrimRight(strings.ToLower(key), "/")
+	}))
+	defer RemoveGroup("keynormalizer")
+	peers := &keyRecorder{}
+	gee.RegisterPeers(peers)
+
+	for _, key := range []string{"A/", "a", "A"} {
+		if v, err := gee.Get(key); err != nil || v.String() != "a" {
+			t.Fatalf("expect %s normalized to a, but %s, %v got", key, v, err)
+		}
+	}
+	if !reflect.DeepEqual(loads, []string{"a"}) || gee.Len() != 1 {
+		t.Fatalf("expect one entry and one load for a, but %v, %d got", loads, gee.Len())
+	}
+	if _, ok := gee.GetIfPresent("a/"); !ok {
+		t.Fatal("expect a/ to hit the same entry")
+	}
+
+	// 选择节点和请求远程节点时使用规范化之后的 key
+	if v, err := gee.Get("REMOTE/"); err != nil || v.String() != "from peer" {
+		t.Fatalf("expect value from peer, but %s, %v got", v, err)
+	}
+	if !reflect.DeepEqual(peers.picked, []string{"a", "remote"}) || !reflect.DeepEqual(peers.requested, []string{"remote"}) {
+		t.Fatalf("expect normalized keys for peers, but %v, %v got", peers.picked, peers.requested)
+	}
+
+	gee.Set("Jack/", []byte("630"))
+	if v, ok := gee.GetIfPresent("jack"); !ok || v.String() != "630" {
+		t.Fatalf("expect Set under normalized key, but %s, %v got", v, ok)
+	}
+	gee.Invalidate("A")
+	if _, ok := gee.GetIfPresent("a"); ok {
+		t.Fatal("expect Invalidate under normalized key")
+	}
+}
+
+func TestSetGetter(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	gee := NewGroup("setgetter", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				close(started)
+				<-release
+			}
+			return []byte(key + " from old"), nil
+		}))
+	defer RemoveGroup("setgetter")
+	gee.Get("Tom")
+
+	// 替换时正在进行的加载使用旧的 getter 完成
+	done := make(chan ByteView)
+	go func() {
+		v, _ := gee.Get("slow")
+		done <- v
+	}()
+	<-started
+	gee.SetGetter(GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key + " from new"), nil
+	}))
+	close(release)
+	if v := <-done; v.String() != "slow from old" {
+		t.Fatalf("expect in-flight load to finish with the old getter, but %s got", v)
+	}
+
+	if v, err := gee.Get("Jack"); err != nil || v.String() != "Jack from new" {
+		t.Fatalf("expect miss to use the new getter, but %s, %v got", v, err)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom from old" {
+		t.Fatalf("expect cached entry to remain, but %s, %v got", v, err)
+	}
+}
+
+// 淘汰回调中访问注册表不会使 RemoveGroup 死锁
+func TestRemoveGroupCallbackReentrant(t *testing.T) {
+	gee := NewGroup("removereentrant", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithOnEvictReason(func(key string, reason lru.Reason) {
+		GetGroup("removereentrant")
+	}))
+	gee.Get("Tom")
+
+	done := make(chan bool)
+	go func() { done <- RemoveGroup("removereentrant") }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("expect group removed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RemoveGroup deadlocked on a callback calling GetGroup")
+	}
+}
@@ -70,6 +70,8 @@ func (m *Request) GetKey() string {
 
 type Response struct {
 	Value                []byte   `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	NotFound             bool     `protobuf:"varint,2,opt,name=not_found,json=notFound,proto3" json:"not_found,omitempty"`
+	ContentType          string   `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -107,6 +109,20 @@ func (m *Response) GetValue() []byte {
 	return nil
 }
 
+func (m *Response) GetNotFound() bool {
+	if m != nil {
+		return m.NotFound
+	}
+	return false
+}
+
+func (m *Response) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Request)(nil), "geecachepb.Request")
 	proto.RegisterType((*Response)(nil), "geecachepb.Response")
@@ -115,15 +131,18 @@ func init() {
 func init() { proto.RegisterFile("geecachepb.proto", fileDescriptor_889d0a4ad37a0d42) }
 
 var fileDescriptor_889d0a4ad37a0d42 = []byte{
-	// 148 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x48, 0x4f, 0x4d, 0x4d,
-	0x4e, 0x4c, 0xce, 0x48, 0x2d, 0x48, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x42, 0x88,
-	0x28, 0x19, 0x72, 0xb1, 0x07, 0xa5, 0x16, 0x96, 0xa6, 0x16, 0x97, 0x08, 0x89, 0x70, 0xb1, 0xa6,
-	0x17, 0xe5, 0x97, 0x16, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x41, 0x38, 0x42, 0x02, 0x5c,
-	0xcc, 0xd9, 0xa9, 0x95, 0x12, 0x4c, 0x60, 0x31, 0x10, 0x53, 0x49, 0x81, 0x8b, 0x23, 0x28, 0xb5,
-	0xb8, 0x20, 0x3f, 0xaf, 0x38, 0x15, 0xa4, 0xa7, 0x2c, 0x31, 0xa7, 0x34, 0x15, 0xac, 0x87, 0x27,
-	0x08, 0xc2, 0x31, 0xb2, 0xe3, 0xe2, 0x72, 0x07, 0x69, 0x76, 0x06, 0x59, 0x22, 0x64, 0xc0, 0xc5,
-	0xec, 0x9e, 0x5a, 0x22, 0x24, 0xac, 0x87, 0xe4, 0x10, 0xa8, 0x9d, 0x52, 0x22, 0xa8, 0x82, 0x10,
-	0x53, 0x93, 0xd8, 0xc0, 0xee, 0x34, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x5c, 0xd5, 0xdd, 0x09,
-	0xbb, 0x00, 0x00, 0x00,
+	// 195 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x8f, 0xbf, 0x6f, 0x83, 0x30,
+	0x10, 0x85, 0x45, 0x51, 0x5b, 0xb8, 0x32, 0x20, 0x97, 0x01, 0xb5, 0x4b, 0xcb, 0x94, 0x09, 0xe5,
+	0xc7, 0x9e, 0x25, 0x52, 0xd8, 0xad, 0xec, 0x04, 0xc8, 0x85, 0x48, 0x89, 0x7c, 0x0e, 0x9c, 0x23,
+	0xf1, 0xdf, 0x47, 0x36, 0x48, 0x49, 0x36, 0xbf, 0x4f, 0x7a, 0xbe, 0xef, 0x41, 0xdc, 0x22, 0x36,
+	0x55, 0x73, 0x42, 0x5d, 0xe7, 0xba, 0x23, 0x26, 0x01, 0x0f, 0x92, 0x2d, 0xe0, 0x53, 0xe2, 0xd5,
+	0x60, 0xcf, 0x22, 0x81, 0xf7, 0xb6, 0x23, 0xa3, 0x53, 0xef, 0xcf, 0x9b, 0x85, 0x72, 0x0c, 0x22,
+	0x06, 0xff, 0x8c, 0x43, 0xfa, 0xe6, 0x98, 0x7d, 0x66, 0x7b, 0x08, 0x24, 0xf6, 0x9a, 0x54, 0x8f,
+	0xb6, 0x73, 0xab, 0x2e, 0x06, 0x5d, 0x27, 0x92, 0x63, 0x10, 0xbf, 0x10, 0x2a, 0xe2, 0xf2, 0x48,
+	0x46, 0x1d, 0x5c, 0x33, 0x90, 0x81, 0x22, 0xde, 0xda, 0x2c, 0xfe, 0x21, 0x6a, 0x48, 0x31, 0x2a,
+	0x2e, 0x79, 0xd0, 0x98, 0xfa, 0xee, 0xe7, 0xaf, 0x89, 0xed, 0x06, 0x8d, 0xcb, 0x35, 0x40, 0x61,
+	0x8f, 0x6f, 0xac, 0xa4, 0x98, 0x83, 0x5f, 0x20, 0x8b, 0xef, 0xfc, 0x69, 0xc8, 0xe4, 0xfc, 0x93,
+	0xbc, 0xc2, 0xd1, 0xaa, 0xfe, 0x70, 0x3b, 0x57, 0xf7, 0x01, 0x00, 0xb6, 0x48, 0x66, 0x1b, 0xfb,
+	0x00, 0x00, 0x00,
 }
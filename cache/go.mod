@@ -2,4 +2,7 @@ module cache
 
 go 1.13
 
-require github.com/golang/protobuf v1.3.3
\ No newline at end of file
+require (
+	github.com/golang/protobuf v1.3.3
+	go.uber.org/goleak v1.1.12
+)
@@ -0,0 +1,55 @@
+package hashtest_test
+
+import (
+	"cache"
+	"cache/consistenthash"
+	"cache/hashtest"
+	"fmt"
+)
+
+// 每个节点只有一个虚拟节点，按 positions 把 key 路由到指定的节点
+func Example() {
+	const (
+		self  = "http://localhost:8001"
+		peerA = "http://localhost:8002"
+		peerB = "http://localhost:8003"
+	)
+	positions := map[string]uint32{
+		hashtest.VirtualNode(peerA, 0): 100,
+		hashtest.VirtualNode(peerB, 0): 200,
+		hashtest.VirtualNode(self, 0):  300,
+		"Tom":                          50,  // 顺时针第一个节点为 peerA
+		"Jack":                         150, // peerB
+		"Sam":                          250, // 本机
+	}
+	p := cache.NewHTTPPool(self, cache.WithPoolLogger(cache.NopLogger{}),
+		cache.WithReplicas(1), cache.WithHashFunc(hashtest.Fixed(positions)))
+	p.Set(self, peerA, peerB)
+
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if peer, ok := p.PickPeer(key); ok {
+			fmt.Println(key, peer)
+		} else {
+			fmt.Println(key, "self")
+		}
+	}
+	// Output:
+	// Tom http://localhost:8002/_cache/
+	// Jack http://localhost:8003/_cache/
+	// Sam self
+}
+
+// 带有种子的哈希环使用 VirtualNodeSeeded 生成虚拟节点的位置
+func ExampleVirtualNodeSeeded() {
+	const seed = "blue"
+	positions := map[string]uint32{
+		hashtest.VirtualNodeSeeded(seed, "a", 0): 100,
+		hashtest.VirtualNodeSeeded(seed, "b", 0): 200,
+		"Tom":                                    150,
+	}
+	m := consistenthash.NewWithSeed(1, hashtest.Fixed(positions), seed)
+	m.Add("a", "b")
+	fmt.Println(m.Get("Tom"))
+	// Output:
+	// b
+}
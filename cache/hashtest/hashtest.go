@@ -0,0 +1,33 @@
+// Package hashtest 提供结果可以预测的哈希函数，用于在测试中把 key 和节点放到哈希环上指定的位置，
+// 可以传给 consistenthash.New 或 cache.WithHashFunc
+package hashtest
+
+import (
+	"cache/consistenthash"
+	"strconv"
+)
+
+// Atoi 把数据解析为十进制整数作为哈希值，无法解析时返回 0。
+// 节点 "6" 的第 i 个虚拟节点为 "i6"，例如 3 个虚拟节点位于 6、16、26
+func Atoi(data []byte) uint32 {
+	i, _ := strconv.Atoi(string(data))
+	return uint32(i)
+}
+
+// Fixed 返回按 positions 查表的哈希函数，不在表中的数据返回 0（即环上第一个虚拟节点之前）。
+// 节点的虚拟节点使用 VirtualNode 生成表中的 key
+func Fixed(positions map[string]uint32) consistenthash.Hash {
+	return func(data []byte) uint32 {
+		return positions[string(data)]
+	}
+}
+
+// VirtualNode 返回节点的第 replica 个虚拟节点在计算哈希时使用的数据，用于没有种子的哈希环（consistenthash.New）
+func VirtualNode(node string, replica int) string {
+	return VirtualNodeSeeded("", node, replica)
+}
+
+// VirtualNodeSeeded 与 VirtualNode 相同，用于以 seed 创建的哈希环（consistenthash.NewWithSeed、cache.WithHashSeed）
+func VirtualNodeSeeded(seed, node string, replica int) string {
+	return seed + strconv.Itoa(replica) + node
+}
@@ -1,22 +1,39 @@
 package cache
 
 import (
+	"bytes"
 	"cache/consistenthash"
 	pb "cache/geecachepb"
+	"cache/jumphash"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/golang/protobuf/proto"
 )
 
 const (
 	defaultBasePath = "/_cache/"
 	defaultReplicas = 50
+	// 查询 key 所属节点的调试接口：<basePath>_owner/<key>
+	ownerPath = "_owner/"
+	// 查询 key 的候选节点的接口：<basePath>_candidates/<key>?n=<个数>
+	candidatesPath = "_candidates/"
+	// 候选节点接口默认返回的节点数
+	defaultCandidates = 3
+	// 不是来自节点的请求带上该查询参数（如 ?stream=1）时直接返回原始的值，超过阈值的大对象从数据源流式写入。
+	// 节点之间的请求从不带该参数，始终得到编码后的响应
+	streamParam = "stream"
+	// 默认的远程节点响应体大小上限
+	defaultMaxResponseBytes = 64 << 20
 )
 
 // HTTPPool 代表了一个节点的信息和与其他节点通信的方式
@@ -30,34 +47,272 @@ type HTTPPool struct {
 	// 互斥锁
 	mu sync.Mutex
 
+	// 串行化 Set：新的节点信息在 mu 之外构建，并发的 Set 可能以与调用相反的顺序完成，较旧的节点列表覆盖较新的。
+	// httpGetters 只在 Set 中替换，持有 setMu 时可以不加 mu 读取
+	setMu sync.Mutex
+
+	// 一致性哈希的虚拟节点倍数
+	replicas int
+
+	// 一致性哈希使用的哈希函数，为 nil 时使用 crc32
+	hashFn consistenthash.Hash
+	// 一致性哈希的种子，见 consistenthash.NewWithSeed
+	hashSeed string
+
+	// 创建节点选择算法，为 nil 时使用一致性哈希环
+	newRing func() Ring
+
 	// 根据具体的 key 选择节点
-	peers *consistenthash.Map
+	peers Ring
 
 	// httpGetter 实现了 PeerGetter 接口，用于获取远程节点的数据
 	// 映射远程节点与之对应的httpGetter，每一个远程节点对应一个 httpGetter,
-	// 因为 httpGetter 与远程节点的地址 baseURL 有关
+	// 因为 httpGetter 与远程节点的地址 baseURL 有关。本机不需要 httpGetter，不在其中
 	httpGetters map[string]*httpGetter
+
+	// 最近一次 Set 设置的节点数（包括本机）
+	nodes int
+
+	// 日志输出
+	logger Logger
+
+	// 是否在每次选择远程节点时输出日志，默认关闭
+	logPicks bool
+
+	// 租户前缀：选择节点和请求远程节点时加在 key 之前，ServeHTTP 收到请求时去掉
+	tenant string
+
+	// 是否开启查询 key 所属节点的调试接口
+	ownerEndpoint bool
+
+	// 是否开启查询 key 的候选节点的接口
+	candidatesEndpoint bool
+
+	// 是否接受其他节点通过 PUT 写入缓存
+	peerWrites bool
+
+	// 响应体解码失败时是否把整个响应体作为值，见 WithRawBodyFallback
+	rawFallback bool
+
+	// 请求远程节点时使用的编码格式，默认为 protobuf
+	codec Codec
+
+	// ServeHTTP 支持的编码格式
+	codecs []Codec
+
+	// 节点变化之后调用的回调，受 mu 保护。取消注册时替换为新的切片，Set 在锁外遍历的旧切片不受影响
+	onRingChange []*ringCallback
+
+	// 远程节点响应体的最大字节数
+	maxResponseBytes int64
+
+	// 每个远程节点同时进行的请求数上限，0 表示不限制
+	maxPeerRequests int
+	// 超过上限时的处理方式
+	peerLimitPolicy PeerLimitPolicy
+
+	// 访问远程节点使用的 HTTP 客户端，每个 HTTPPool 独立，Close 时关闭空闲连接
+	client *http.Client
+
+	closeOnce sync.Once
+	// 是否已经 Close，受 mu 保护
+	closed bool
+}
+
+// Option 用于在实例化 HTTPPool 时修改默认配置
+type Option func(*HTTPPool)
+
+// 设置节点通信路径，需以 "/" 开头和结尾
+func WithBasePath(basePath string) Option {
+	return func(p *HTTPPool) {
+		p.basePath = basePath
+	}
+}
+
+// 设置一致性哈希的虚拟节点倍数，不大于 0 时使用默认值
+func WithReplicas(replicas int) Option {
+	return func(p *HTTPPool) {
+		if replicas > 0 {
+			p.replicas = replicas
+		}
+	}
+}
+
+// 设置一致性哈希使用的哈希函数（如 fnv、murmur3），为 nil 时使用 crc32
+func WithHashFunc(fn consistenthash.Hash) Option {
+	return func(p *HTTPPool) {
+		p.hashFn = fn
+	}
+}
+
+// 设置一致性哈希的种子，相同的节点使用不同的种子会得到不同的 key 分配，用于 A/B 路由等场景
+func WithHashSeed(seed string) Option {
+	return func(p *HTTPPool) {
+		p.hashSeed = seed
+	}
+}
+
+// 使用 Jump Consistent Hash 代替哈希环选择节点，节点按 Set 传入的顺序编号
+func WithJumpHash() Option {
+	return func(p *HTTPPool) {
+		p.newRing = func() Ring { return jumphash.New(nil) }
+	}
+}
+
+// 使用自定义的节点选择算法，每次 Set 都会调用 newRing 创建新的实例
+func WithRing(newRing func() Ring) Option {
+	return func(p *HTTPPool) {
+		p.newRing = newRing
+	}
+}
+
+// 设置 HTTPPool 的日志输出，传入 NopLogger{} 关闭日志
+func WithPoolLogger(l Logger) Option {
+	return func(p *HTTPPool) {
+		p.logger = l
+	}
+}
+
+// 设置是否在每次选择远程节点时输出日志，默认关闭
+func WithPickLog(enabled bool) Option {
+	return func(p *HTTPPool) {
+		p.logPicks = enabled
+	}
+}
+
+// 设置租户前缀，共享节点的不同租户的相同 key 会被独立地路由和缓存。
+// 租户的 Group 需要以 prefix 开头命名（如 "t1:scores"），ServeHTTP 只提供这些 Group，
+// 同一进程中不同租户的缓存因此互相隔离；Group 的 getter 收到的 key 不带前缀
+func WithTenant(prefix string) Option {
+	return func(p *HTTPPool) {
+		p.tenant = prefix
+	}
+}
+
+// 开启调试接口 GET <basePath>_owner/<key>，返回 key 所属的节点以及是否为本机，不会读取缓存
+func WithOwnerEndpoint() Option {
+	return func(p *HTTPPool) {
+		p.ownerEndpoint = true
+	}
+}
+
+// 开启候选节点接口：GET <basePath>_candidates/<key>?n=<个数> 以 JSON 返回 key 在环上按顺时针顺序的
+// 最多 n 个候选节点（默认 3 个），第一个是所属节点。客户端可以据此自己选择节点（如按延迟），见 CandidatePeers
+func WithCandidatesEndpoint() Option {
+	return func(p *HTTPPool) {
+		p.candidatesEndpoint = true
+	}
+}
+
+// 接受其他节点通过 PUT <basePath><group>/<key> 写入缓存（只写缓存，不写数据源），
+// 通过 DELETE 删除缓存，配合 Group 的 WithPropagateToOwner、WithInvalidateBroadcast 使用。
+// 写入接口没有鉴权，只应在内网中开启
+func WithPeerWrites() Option {
+	return func(p *HTTPPool) {
+		p.peerWrites = true
+	}
+}
+
+// 远程节点的响应体解码失败时，把整个响应体作为值而不是返回错误。只用于滚动升级期间
+// 新旧节点的报文格式不一致（如旧节点直接返回原始的值）的过渡阶段，升级完成后应当关闭：
+// 格式错误的响应会被当作值缓存
+func WithRawBodyFallback() Option {
+	return func(p *HTTPPool) {
+		p.rawFallback = true
+	}
+}
+
+// 设置请求远程节点时使用的编码格式。ServeHTTP 总是支持内置的编码格式，
+// 自定义的编码格式也会加入支持列表
+func WithCodec(c Codec) Option {
+	return func(p *HTTPPool) {
+		p.codec = c
+	}
+}
+
+// 远程节点的响应体超过 WithMaxResponseBytes 设置的上限时返回的错误
+var ErrResponseTooLarge = errors.New("peer response too large")
+
+// 设置远程节点响应体的最大字节数，超过时停止读取并返回 ErrResponseTooLarge，
+// 避免异常的节点返回巨大的响应耗尽内存。默认为 64MB，n <= 0 时使用默认值
+func WithMaxResponseBytes(n int64) Option {
+	return func(p *HTTPPool) {
+		if n > 0 {
+			p.maxResponseBytes = n
+		}
+	}
+}
+
+// PeerLimitPolicy 是请求远程节点的并发数超过 WithMaxPeerRequests 设置的上限时的处理方式
+type PeerLimitPolicy int
+
+const (
+	// 排队等待，直到有请求完成或 ctx 取消
+	PeerLimitWait PeerLimitPolicy = iota
+	// 立即返回 ErrPeerBusy，Group 会回退到本地数据源
+	PeerLimitFailFast
+)
+
+// 请求远程节点的并发数达到上限且使用 PeerLimitFailFast 时返回的错误
+var ErrPeerBusy = errors.New("too many concurrent requests to peer")
+
+// 限制同时发往每个远程节点的请求数最多为 n，避免大量 key 同时未命中时压垮同一个节点。
+// 超过上限的请求按 policy 排队或立即失败。n <= 0 表示不限制
+func WithMaxPeerRequests(n int, policy PeerLimitPolicy) Option {
+	return func(p *HTTPPool) {
+		if n > 0 {
+			p.maxPeerRequests = n
+			p.peerLimitPolicy = policy
+		}
+	}
 }
 
 // 实例化HTTP服务器（实现了 handler 接口）
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+func NewHTTPPool(self string, opts ...Option) *HTTPPool {
+	p := &HTTPPool{
+		self:             self,
+		basePath:         defaultBasePath,
+		replicas:         defaultReplicas,
+		logger:           stdLogger{},
+		maxResponseBytes: defaultMaxResponseBytes,
+		client: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.codecs = builtinCodecs
+	if p.codec == nil {
+		p.codec = ProtobufCodec
+	} else if _, ok := codecByContentType(p.codec.ContentType(), p.codecs); !ok {
+		p.codecs = append([]Codec{p.codec}, builtinCodecs...)
+	}
+	return p
 }
 
 // 日志信息
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logger.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
 // HTTP 服务器处理请求
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 路径不匹配时返回 400，而不是 panic 导致整个进程退出
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		p.Log("unexpected path: %s", r.URL.Path)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	if p.ownerEndpoint && strings.HasPrefix(r.URL.Path[len(p.basePath):], ownerPath) {
+		p.serveOwner(w, r.URL.Path[len(p.basePath)+len(ownerPath):])
+		return
+	}
+	if p.candidatesEndpoint && strings.HasPrefix(r.URL.Path[len(p.basePath):], candidatesPath) {
+		p.serveCandidates(w, r, r.URL.Path[len(p.basePath)+len(candidatesPath):])
+		return
+	}
 	// /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -68,88 +323,607 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupName := parts[0]
 	key := parts[1]
 
+	// 去掉租户前缀，不属于本租户的 Group 和 key 视为不存在
+	if p.tenant != "" {
+		if !strings.HasPrefix(groupName, p.tenant) {
+			http.Error(w, "group not in tenant: "+groupName, http.StatusNotFound)
+			return
+		}
+		if !strings.HasPrefix(key, p.tenant) {
+			http.Error(w, "key not in tenant: "+key, http.StatusNotFound)
+			return
+		}
+		key = key[len(p.tenant):]
+	}
+
 	group := GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
 
+	if r.Method == http.MethodPut {
+		p.servePut(w, r, group, key)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		p.serveDelete(w, group, key)
+		return
+	}
+
+	// 按请求的 Accept 头选择编码格式，没有匹配的编码格式时（包括不带 Accept 的旧版本节点）使用 protobuf。
+	// 只有带上 streamParam 参数或 Accept 明确列出了值的 Content-Type 时才返回原始的值，见 acceptsMediaType
+	accept := r.Header.Get("Accept")
+	codec, ok := negotiateCodec(accept, p.codecs)
+
+	// 超过阈值的大对象直接从数据源流式写入响应，不完整读入内存，只用于明确要求原始值的请求
+	raw := r.URL.Query().Get(streamParam) != ""
+	if raw {
+		rc, err := group.stream(r.Context(), key)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if group.notFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if rc != nil {
+			defer rc.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			if _, err := io.Copy(w, rc); err != nil {
+				p.Log("stream %s: %v", key, err)
+			}
+			return
+		}
+	}
+
 	view, err := group.Get(key)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !group.notFound(err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// key 不存在时，节点之间返回 not_found 的响应，与值为空区分开
+		if raw || !ok {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		p.writeResponse(w, codec, &pb.Response{NotFound: true})
 		return
 	}
 
-	// 将值编码为 protobuf 写入响应体
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	// 请求带上的 ETag 与当前的值相同时返回 304，请求方继续使用已有的值
+	etag := valueETag(view.b)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if raw || !ok && acceptsMediaType(accept, view.ct) {
+		w.Header().Set("Content-Type", view.ContentType())
+		w.Write(view.Bytes())
+		return
+	}
+	res := &pb.Response{Value: view.Bytes(), ContentType: view.ct}
+	if !ok {
+		// 与以前一样返回标记为 application/octet-stream 的 protobuf 响应，旧版本节点可以解码
+		body, err := ProtobufCodec.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+		return
+	}
+	p.writeResponse(w, codec, res)
+}
+
+// 根据值的内容计算 ETag，用于节点之间的条件请求
+func valueETag(b []byte) string {
+	h := fnv.New64a()
+	h.Write(b)
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// 其他节点推送的值，只写入缓存
+func (p *HTTPPool) servePut(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if !p.peerWrites {
+		http.Error(w, "peer writes disabled", http.StatusMethodNotAllowed)
+		return
+	}
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := group.fill(key, value); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 其他节点广播的删除，只删除本机的缓存，不再继续广播
+func (p *HTTPPool) serveDelete(w http.ResponseWriter, group *Group, key string) {
+	if !p.peerWrites {
+		http.Error(w, "peer writes disabled", http.StatusMethodNotAllowed)
+		return
+	}
+	key = group.normalize(key)
+	if err := group.checkKey(key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.invalidateLocal(key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 使用 codec 编码并写入响应
+func (p *HTTPPool) writeResponse(w http.ResponseWriter, codec Codec, res *pb.Response) {
+	body, err := codec.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Type", codec.ContentType())
 	w.Write(body)
 }
 
-// 为 HTTPPool 设置节点信息：设置一致性哈希，设置 httpGetters
-func (p *HTTPPool) Set(peers ...string) {
+// 调试接口返回的 key 所属节点信息
+type ownerInfo struct {
+	Key   string `json:"key"`
+	Owner string `json:"owner"`
+	Self  bool   `json:"self"`
+}
+
+func (p *HTTPPool) serveOwner(w http.ResponseWriter, key string) {
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	owner := ""
+	if p.peers != nil {
+		owner = p.peers.Get(p.tenant + key)
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ownerInfo{Key: key, Owner: owner, Self: owner == p.self})
+}
+
+// 候选节点接口返回的信息
+type candidatesInfo struct {
+	Key        string   `json:"key"`
+	Candidates []string `json:"candidates"`
+}
+
+func (p *HTTPPool) serveCandidates(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	n := defaultCandidates
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n <= 0 {
+			http.Error(w, "invalid n: "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(candidatesInfo{Key: key, Candidates: p.CandidatePeers(key, n)})
+}
+
+// 返回 key 在环上按顺时针顺序的最多 n 个不同的候选节点（可能包括本机），第一个是所属节点，
+// 用于客户端自己选择节点。Ring 没有实现 MultiRing 时只返回所属节点，没有节点时返回 nil
+func (p *HTTPPool) CandidatePeers(key string, n int) []string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	if p.closed || p.peers == nil || n <= 0 {
+		return nil
+	}
+	if r, ok := p.peers.(MultiRing); ok {
+		return r.GetN(p.tenant+key, n)
+	}
+	if owner := p.peers.Get(p.tenant + key); owner != "" {
+		return []string{owner}
+	}
+	return nil
+}
+
+// 为 HTTPPool 设置节点信息：设置一致性哈希，设置 httpGetters。
+// peers 应当包括本机：本机和其他节点一样加入哈希环，key 的分布才与其他节点看到的一致；
+// 但本机不创建 httpGetter，PickPeer 选中本机时返回 false，由 Group 从本地数据源加载。
+// 新的节点信息整体替换旧的，并发的 PickPeer 只会看到替换前或替换后的完整状态。并发的 Set 依次执行，最后一次调用生效
+func (p *HTTPPool) Set(peers ...string) {
+	p.setMu.Lock()
+	defer p.setMu.Unlock()
+	// 在锁外构建新的哈希环和 httpGetters，加锁后只替换指针，
+	// 避免节点很多时重建哈希环阻塞 PickPeer
+	var ring Ring
+	if p.newRing != nil {
+		ring = p.newRing()
+	} else {
+		ring = consistenthash.NewWithSeed(p.replicas, p.hashFn, p.hashSeed)
+	}
+	// consistenthash.Map 的 Add 会推迟排序，使用 AddBatch 在锁外完成排序
+	if b, ok := ring.(interface{ AddBatch([]string) }); ok {
+		b.AddBatch(peers)
+	} else {
+		ring.Add(peers...)
+	}
+	getters := make(map[string]*httpGetter, len(peers))
+	nodes := 0
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if peer == p.self {
+			nodes = 1
+			continue
+		}
+		getters[peer] = &httpGetter{
+			baseURL:     peer + p.basePath,
+			client:      p.client,
+			tenant:      p.tenant,
+			codec:       p.codec,
+			codecs:      p.codecs,
+			maxBytes:    p.maxResponseBytes,
+			rawFallback: p.rawFallback,
+		}
+		if p.maxPeerRequests > 0 {
+			// 仍在列表中的节点沿用原来的信号量，正在进行的请求继续计入并发数
+			if old, ok := p.httpGetters[peer]; ok && old.sem != nil {
+				getters[peer].sem = old.sem
+			} else {
+				getters[peer].sem = make(chan struct{}, p.maxPeerRequests)
+			}
+			getters[peer].failFast = p.peerLimitPolicy == PeerLimitFailFast
+		}
+	}
+
+	p.mu.Lock()
+	p.peers = ring
+	p.httpGetters = getters
+	p.nodes = nodes + len(getters)
+	callbacks := p.onRingChange
+	p.mu.Unlock()
+
+	// 回调中会调用 PickPeer，需要在释放锁之后执行
+	for _, c := range callbacks {
+		c.fn()
+	}
+}
+
+// 通过 OnRingChange 注册的回调，使用指针区分多次注册的同一个函数
+type ringCallback struct {
+	fn func()
+}
+
+// 实现 RingWatcher 接口，注册节点变化之后调用的回调
+func (p *HTTPPool) OnRingChange(fn func()) (unregister func()) {
+	c := &ringCallback{fn: fn}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onRingChange = append(p.onRingChange, c)
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		callbacks := make([]*ringCallback, 0, len(p.onRingChange))
+		for _, other := range p.onRingChange {
+			if other != c {
+				callbacks = append(callbacks, other)
+			}
+		}
+		p.onRingChange = callbacks
 	}
 }
 
-// 实现PeerPicker接口，通过 key 获取节点
+// 实现 PeerCounter 接口，返回最近一次 Set 设置的节点数，Close 之后为 0
+func (p *HTTPPool) PeerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0
+	}
+	return p.nodes
+}
+
+// 实现了 PeerLister 接口，返回除本机以外的全部节点
+func (p *HTTPPool) ListPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for _, getter := range p.httpGetters {
+		peers = append(peers, getter)
+	}
+	return peers
+}
+
+// 实现PeerPicker接口，通过 key 获取节点。
+// 未调用 Set 或节点列表为空时返回 false，Group 会从本地数据源加载（单机模式）
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
+	if p.closed || p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(p.tenant + key); peer != "" && peer != p.self {
+		if p.logPicks {
+			p.Log("Pick peer %s", peer)
+		}
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// 返回 key 在环上的第二个候选节点，首选节点失败时使用。Ring 没有实现 MultiRing 时 ok 为 false
+func (p *HTTPPool) PickFallbackPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.peers == nil {
+		return nil, false
+	}
+	r, ok := p.peers.(MultiRing)
+	if !ok {
+		return nil, false
+	}
+	nodes := r.GetN(p.tenant+key, 2)
+	if len(nodes) < 2 || nodes[1] == p.self {
+		return nil, false
+	}
+	if p.logPicks {
+		p.Log("Pick fallback peer %s", nodes[1])
+	}
+	return p.httpGetters[nodes[1]], true
+}
+
+// 关闭 HTTPPool：关闭空闲连接，之后 PickPeer 总是返回 false。
+// 可以多次调用
+func (p *HTTPPool) Close() error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+		p.client.CloseIdleConnections()
+	})
+	return nil
+}
+
 // httpGetter 类型：用于获取远程节点的数据
 type httpGetter struct {
 	// 将要访问的远程节点的默认前缀地址
 	baseURL string
+	// 所属 HTTPPool 的 HTTP 客户端
+	client *http.Client
+	// 加在 key 之前的租户前缀
+	tenant string
+	// 请求的编码格式，为 nil 时使用 protobuf
+	codec Codec
+	// 可以解码的编码格式
+	codecs []Codec
+	// 响应体的最大字节数，0 表示不限制
+	maxBytes int64
+	// 解码失败时是否把整个响应体作为值
+	rawFallback bool
+	// 同时进行的请求数的信号量，为 nil 时不限制
+	sem chan struct{}
+	// 达到上限时是否立即返回 ErrPeerBusy
+	failFast bool
+}
+
+// 获取一个请求名额，返回释放名额的函数
+func (h *httpGetter) acquire(ctx context.Context) (func(), error) {
+	if h.sem == nil {
+		return func() {}, nil
+	}
+	if h.failFast {
+		select {
+		case h.sem <- struct{}{}:
+		default:
+			return nil, ErrPeerBusy
+		}
+	} else {
+		select {
+		case h.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-h.sem }, nil
+}
+
+// 返回远程节点的地址
+func (h *httpGetter) String() string {
+	return h.baseURL
 }
 
 // 实现了 PeerGetter 接口
 func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return h.GetContext(context.Background(), in, out)
+}
+
+// 实现了 ContextPeerGetter 接口，ctx 取消时中止请求
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	_, err := h.get(ctx, in, "", out)
+	return err
+}
+
+// 实现了 ConditionalPeerGetter 接口，请求带上 cached 的 ETag，远程节点返回 304 时值没有变化
+func (h *httpGetter) GetIfModified(ctx context.Context, in *pb.Request, cached []byte, out *pb.Response) (bool, error) {
+	return h.get(ctx, in, valueETag(cached), out)
+}
+
+// 获取远程节点的值，etag 不为空时发出条件请求，远程节点返回 304 时 modified 为 false
+func (h *httpGetter) get(ctx context.Context, in *pb.Request, etag string, out *pb.Response) (modified bool, err error) {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.PathEscape(in.GetGroup()),
+		url.PathEscape(h.tenant+in.GetKey()),
 	)
-	res, err := http.Get(u)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
-		return err
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	codec := h.codec
+	if codec == nil {
+		codec = ProtobufCodec
+	}
+	req.Header.Set("Accept", codec.ContentType())
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	res, err := h.client.Do(req)
+	if err != nil {
+		return false, err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotModified && etag != "" {
+		return false, nil
+	}
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return false, &statusError{code: res.StatusCode, status: res.Status}
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	var body io.Reader = res.Body
+	if h.maxBytes > 0 {
+		// 多读一个字节判断是否超过上限
+		body = io.LimitReader(res.Body, h.maxBytes+1)
+	}
+	bytes, err := ioutil.ReadAll(body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return false, fmt.Errorf("reading response body: %v", err)
+	}
+	if h.maxBytes > 0 && int64(len(bytes)) > h.maxBytes {
+		return false, fmt.Errorf("%w: more than %d bytes from %s", ErrResponseTooLarge, h.maxBytes, h.baseURL)
 	}
 
-	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("decoding response body: %v", err)
+	// 按响应的 Content-Type 解码，未知或缺失时按请求的编码格式解码
+	if c, ok := codecByContentType(res.Header.Get("Content-Type"), h.codecs); ok {
+		codec = c
 	}
+	if err = codec.Unmarshal(bytes, out); err != nil {
+		if h.rawFallback {
+			out.Reset()
+			out.Value = bytes
+			return true, nil
+		}
+		return false, &DecodeError{Peer: h.baseURL, Group: in.GetGroup(), Key: in.GetKey(), ContentType: res.Header.Get("Content-Type"), Err: err}
+	}
+
+	return true, nil
+}
 
+// 实现了 PeerSetter 接口，把值写入远程节点的缓存，远程节点需要开启 WithPeerWrites
+func (h *httpGetter) Set(in *pb.Request, value []byte) error {
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.PathEscape(in.GetGroup()),
+		url.PathEscape(h.tenant+in.GetKey()),
+	)
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	release, err := h.acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode, status: res.Status}
+	}
 	return nil
 }
 
+// 实现了 PeerInvalidator 接口，删除远程节点上的缓存，远程节点需要开启 WithPeerWrites
+func (h *httpGetter) Invalidate(in *pb.Request) error {
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.PathEscape(in.GetGroup()),
+		url.PathEscape(h.tenant+in.GetKey()),
+	)
+	req, err := http.NewRequest(http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	release, err := h.acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode, status: res.Status}
+	}
+	return nil
+}
+
+// DecodeError 是远程节点的响应体无法解码时返回的错误，通常是节点之间的版本或编码格式不一致
+type DecodeError struct {
+	// 远程节点的地址
+	Peer  string
+	Group string
+	Key   string
+	// 响应的 Content-Type
+	ContentType string
+	// 解码器返回的错误
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding response from %s for %s/%s (Content-Type %q): %v", e.Peer, e.Group, e.Key, e.ContentType, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// 远程节点返回的非 200 响应
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
+
+// 从远程节点获取失败之后是否值得尝试其他节点：5xx 和超时可以重试，404 等其他错误不重试
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
 // TODO 有什么用？
 // var _ PeerGetter = (*httpGetter)(nil)
 // var _ PeerPicker = (*HTTPPool)(nil)
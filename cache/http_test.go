@@ -0,0 +1,1119 @@
+package cache
+
+import (
+	"bytes"
+	"cache/consistenthash"
+	pb "cache/geecachepb"
+	"cache/hashtest"
+	"cache/jumphash"
+	"cache/rendezvous"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/goleak"
+)
+
+func TestServeHTTPUnexpectedPath(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001")
+	req := httptest.NewRequest(http.MethodGet, "/other/scores/Tom", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect status %d, but %d got", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001", WithBasePath("/_v2/"))
+	req := httptest.NewRequest(http.MethodGet, "/_cache/scores/Tom", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect status %d, but %d got", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/_v2/nosuchgroup/Tom", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect status %d, but %d got", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWithHashFunc(t *testing.T) {
+	hash := func(data []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(data)
+		return h.Sum32()
+	}
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	p1 := NewHTTPPool("http://localhost:9001", WithHashFunc(hash), WithReplicas(10))
+	p2 := NewHTTPPool("http://localhost:9002", WithHashFunc(hash), WithReplicas(10))
+	p1.Set(peers...)
+	p2.Set(peers...)
+
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		g1, ok1 := p1.PickPeer(key)
+		g2, ok2 := p2.PickPeer(key)
+		if !ok1 || !ok2 {
+			t.Fatalf("pick peer for %s failed", key)
+		}
+		if g1.(*httpGetter).baseURL != g2.(*httpGetter).baseURL {
+			t.Fatalf("key %s routed to %s and %s", key,
+				g1.(*httpGetter).baseURL, g2.(*httpGetter).baseURL)
+		}
+	}
+
+	// 路由由注入的哈希函数决定：与同样配置的 consistenthash.Map 一致，且不同于默认的 crc32
+	ref := consistenthash.New(10, hash)
+	ref.Add(peers...)
+	def := NewHTTPPool("http://localhost:9001", WithReplicas(10))
+	def.Set(peers...)
+	differs := false
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if got := p1.peers.Get(key); got != ref.Get(key) {
+			t.Fatalf("expect %s routed by the custom hash to %s, but %s got", key, ref.Get(key), got)
+		}
+		if p1.peers.Get(key) != def.peers.Get(key) {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Fatal("expect the custom hash to route differently from crc32")
+	}
+
+	// 不大于 0 的虚拟节点倍数使用默认值
+	if p := NewHTTPPool("http://localhost:9001", WithReplicas(0)); p.replicas != defaultReplicas {
+		t.Fatalf("expect default replicas, but %d got", p.replicas)
+	}
+}
+
+func TestWithReplicas(t *testing.T) {
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	def := NewHTTPPool("http://localhost:9001")
+	few := NewHTTPPool("http://localhost:9001", WithReplicas(3))
+	many := NewHTTPPool("http://localhost:9001", WithReplicas(200))
+	for _, p := range []*HTTPPool{def, few, many} {
+		p.Set(peers...)
+	}
+
+	// 同一进程中的多个 HTTPPool 使用各自的虚拟节点倍数
+	for p, want := range map[*HTTPPool]int{def: defaultReplicas, few: 3, many: 200} {
+		ring := p.peers.(*consistenthash.Map)
+		if ring.Replicas() != want {
+			t.Fatalf("expect %d replicas, but %d got", want, ring.Replicas())
+		}
+		total := 0
+		for _, n := range ring.Distribution() {
+			total += n
+		}
+		if total != want*len(peers) {
+			t.Fatalf("expect %d virtual nodes, but %d got", want*len(peers), total)
+		}
+	}
+	// 不同的虚拟节点倍数把 key 分到不同的节点
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if few.peers.Get(key) != many.peers.Get(key) {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("expect different replica counts to place some keys on different nodes")
+	}
+}
+
+func TestWithJumpHash(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001", WithJumpHash())
+	p.Set("http://localhost:8001", "http://localhost:8002")
+	if _, ok := p.peers.(*jumphash.Map); !ok {
+		t.Fatalf("expect *jumphash.Map, but %T got", p.peers)
+	}
+}
+
+// stubRing 总是选择第一个节点
+type stubRing struct {
+	nodes []string
+}
+
+func (r *stubRing) Add(nodes ...string) { r.nodes = append(r.nodes, nodes...) }
+func (r *stubRing) Remove(node string)  {}
+func (r *stubRing) Get(key string) string {
+	if len(r.nodes) == 0 {
+		return ""
+	}
+	return r.nodes[0]
+}
+
+func TestWithRing(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001", WithRing(func() Ring { return &stubRing{} }))
+	p.Set("http://localhost:8002", "http://localhost:8003")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		peer, ok := p.PickPeer(key)
+		if !ok || peer.(*httpGetter).baseURL != "http://localhost:8002"+defaultBasePath {
+			t.Fatalf("expect key %s routed to the first peer", key)
+		}
+	}
+
+	// 选中自己时不返回远程节点
+	p.Set("http://localhost:8001", "http://localhost:8002")
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatal("expect self picked")
+	}
+}
+
+func TestSetSerialized(t *testing.T) {
+	building := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	p := NewHTTPPool("http://localhost:8001", WithRing(func() Ring {
+		// 第一次 Set 构建哈希环时阻塞
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(building)
+			<-release
+		}
+		return &stubRing{}
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	}()
+	<-building
+	go func() {
+		defer wg.Done()
+		p.Set("http://localhost:8001", "http://localhost:8002")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := p.PeerCount(); n != 2 {
+		t.Fatalf("expect the later Set to win with 2 nodes, but %d got", n)
+	}
+}
+
+func TestWithRendezvousRing(t *testing.T) {
+	var _ Ring = rendezvous.New()
+	p := NewHTTPPool("http://localhost:8001", WithRing(func() Ring { return rendezvous.New() }))
+	p.Set("http://localhost:8001", "http://localhost:8002")
+	if _, ok := p.peers.(*rendezvous.Map); !ok {
+		t.Fatalf("expect *rendezvous.Map, but %T got", p.peers)
+	}
+}
+
+func TestRingChangeDropsUnownedKeys(t *testing.T) {
+	loads := 0
+	gee := NewGroup("rebalance", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("rebalance")
+
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self, WithRing(func() Ring { return &stubRing{} }))
+	p.Set(self)
+	gee.RegisterPeers(p)
+
+	if _, err := gee.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("expect Tom loaded locally, but %v got", err)
+	}
+
+	// 重新设置节点后 Tom 属于另一个（不可达的）节点，本地缓存被删除，
+	// 下一次 Get 重新加载而不是返回旧值
+	p.Set("http://127.0.0.1:1", self)
+	if _, ok := gee.mainCache.get("Tom"); ok {
+		t.Fatal("expect Tom dropped after rebalance")
+	}
+	if _, err := gee.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expect Tom re-fetched, but %d loads got", loads)
+	}
+}
+
+func TestRemoveGroupUnregistersRingCallback(t *testing.T) {
+	gee := NewGroup("rebalance-remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	p := NewHTTPPool("http://localhost:8001", WithRing(func() Ring { return &stubRing{} }))
+	gee.RegisterPeers(p)
+	other := p.OnRingChange(func() {})
+	if n := len(p.onRingChange); n != 2 {
+		t.Fatalf("expect 2 callbacks, but %d got", n)
+	}
+
+	// 删除 Group 后 HTTPPool 不再持有它的回调，其他回调不受影响
+	RemoveGroup("rebalance-remove")
+	if n := len(p.onRingChange); n != 1 {
+		t.Fatalf("expect the group's callback removed, but %d callbacks got", n)
+	}
+	other()
+	other()
+	if n := len(p.onRingChange); n != 0 {
+		t.Fatalf("expect no callbacks, but %d got", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("630")})
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPool("http://localhost:8001", WithRing(func() Ring { return &stubRing{} }))
+	p.Set(srv.URL)
+	peer, ok := p.PickPeer("Tom")
+	if !ok {
+		t.Fatal("expect remote peer picked")
+	}
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "scores", Key: "Tom"}, res); err != nil || string(res.Value) != "630" {
+		t.Fatalf("expect 630, but %s, %v got", res.Value, err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal("expect Close to be idempotent")
+	}
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatal("expect no peer picked after Close")
+	}
+}
+
+func TestTenant(t *testing.T) {
+	// 两个租户共享同一个进程，各自的 Group 以租户前缀命名
+	for _, tenant := range []string{"t1", "t2"} {
+		tenant := tenant
+		NewGroup(tenant+":tenant", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(tenant + " value of " + key), nil
+			}))
+		defer RemoveGroup(tenant + ":tenant")
+	}
+
+	t1 := NewHTTPPool("http://localhost:8001", WithTenant("t1:"), WithPoolLogger(NopLogger{}))
+	t2 := NewHTTPPool("http://localhost:8002", WithTenant("t2:"), WithPoolLogger(NopLogger{}))
+	srv1 := httptest.NewServer(t1)
+	defer srv1.Close()
+	srv2 := httptest.NewServer(t2)
+	defer srv2.Close()
+
+	g1 := &httpGetter{baseURL: srv1.URL + defaultBasePath, client: http.DefaultClient, tenant: "t1:"}
+	g2 := &httpGetter{baseURL: srv2.URL + defaultBasePath, client: http.DefaultClient, tenant: "t2:"}
+
+	res := &pb.Response{}
+	if err := g1.Get(&pb.Request{Group: "t1:tenant", Key: "a b/c"}, res); err != nil || string(res.Value) != "t1 value of a b/c" {
+		t.Fatalf("expect tenant prefix stripped, but %s, %v got", res.Value, err)
+	}
+	// 相同的 key 在不同租户下读到各自的值
+	if err := g2.Get(&pb.Request{Group: "t2:tenant", Key: "a b/c"}, res); err != nil || string(res.Value) != "t2 value of a b/c" {
+		t.Fatalf("expect t2's own value, but %s, %v got", res.Value, err)
+	}
+	// 不能读取其他租户的 Group，也不能使用其他租户的 key
+	cross := &httpGetter{baseURL: srv1.URL + defaultBasePath, client: http.DefaultClient, tenant: "t1:"}
+	if err := cross.Get(&pb.Request{Group: "t2:tenant", Key: "Tom"}, res); err == nil {
+		t.Fatal("expect another tenant's group rejected")
+	}
+	wrong := &httpGetter{baseURL: srv1.URL + defaultBasePath, client: http.DefaultClient, tenant: "t2:"}
+	if err := wrong.Get(&pb.Request{Group: "t1:tenant", Key: "Tom"}, res); err == nil {
+		t.Fatal("expect request from another tenant rejected")
+	}
+
+	// 相同的 key 在不同租户下独立路由
+	keys1, keys2 := &recordRing{}, &recordRing{}
+	t1 = NewHTTPPool("http://localhost:8001", WithTenant("t1:"), WithRing(func() Ring { return keys1 }))
+	t2 = NewHTTPPool("http://localhost:8001", WithTenant("t2:"), WithRing(func() Ring { return keys2 }))
+	t1.Set("http://localhost:8002")
+	t2.Set("http://localhost:8002")
+	t1.PickPeer("Tom")
+	t2.PickPeer("Tom")
+	if keys1.keys[0] != "t1:Tom" || keys2.keys[0] != "t2:Tom" {
+		t.Fatalf("expect ring keys prefixed by tenant, but %v and %v got", keys1.keys, keys2.keys)
+	}
+}
+
+// recordRing 记录查询过的 key
+type recordRing struct {
+	stubRing
+	keys []string
+}
+
+func (r *recordRing) Get(key string) string {
+	r.keys = append(r.keys, key)
+	return r.stubRing.Get(key)
+}
+
+func TestOwnerEndpoint(t *testing.T) {
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self, WithOwnerEndpoint(), WithPoolLogger(NopLogger{}))
+	p.Set(self, "http://localhost:8002", "http://localhost:8003")
+
+	for _, key := range []string{"Tom", "Jack", "Sam", "a/b"} {
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"_owner/"+key, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+
+		var info ownerInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		peer, ok := p.PickPeer(key)
+		if ok && (info.Self || peer.(*httpGetter).baseURL != info.Owner+defaultBasePath) {
+			t.Fatalf("expect owner of %s to be %s, but %+v got", key, peer.(*httpGetter).baseURL, info)
+		}
+		if !ok && (!info.Self || info.Owner != self) {
+			t.Fatalf("expect %s owned by self, but %+v got", key, info)
+		}
+	}
+
+	// 默认不开启
+	p = NewHTTPPool(self, WithPoolLogger(NopLogger{}))
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"_owner/Tom", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 when disabled, but %d got", w.Code)
+	}
+}
+
+func TestCandidatePeers(t *testing.T) {
+	// 三个节点在环上的位置依次为 100、200、300
+	positions := map[string]uint32{
+		hashtest.VirtualNode("http://localhost:8001", 0): 100,
+		hashtest.VirtualNode("http://localhost:8002", 0): 200,
+		hashtest.VirtualNode("http://localhost:8003", 0): 300,
+		"Tom":  150,
+		"Jack": 350, // 跨过环的起点
+	}
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self, WithReplicas(1), WithHashFunc(hashtest.Fixed(positions)),
+		WithCandidatesEndpoint(), WithPoolLogger(NopLogger{}))
+	if got := p.CandidatePeers("Tom", 3); got != nil {
+		t.Fatalf("expect no candidates without peers, but %v got", got)
+	}
+	p.Set(self, "http://localhost:8002", "http://localhost:8003")
+
+	cases := []struct {
+		key  string
+		n    string
+		want []string
+	}{
+		{"Tom", "", []string{"http://localhost:8002", "http://localhost:8003", "http://localhost:8001"}},
+		{"Jack", "2", []string{"http://localhost:8001", "http://localhost:8002"}},
+		{"Jack", "10", []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"_candidates/"+c.key+"?n="+c.n, nil))
+		var info candidatesInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Key != c.key || !reflect.DeepEqual(info.Candidates, c.want) {
+			t.Fatalf("expect clockwise candidates %v for %s, but %+v got", c.want, c.key, info)
+		}
+		// 第一个候选节点与 PickPeer 一致
+		if peer, ok := p.PickPeer(c.key); ok && peer.(*httpGetter).baseURL != info.Candidates[0]+defaultBasePath {
+			t.Fatalf("expect first candidate to be the owner, but %+v got", info)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"_candidates/Tom?n=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid n, but %d got", w.Code)
+	}
+}
+
+// 后台不断用大量节点调用 Set，测量同时进行的 PickPeer 的耗时
+func BenchmarkPickPeerDuringSet(b *testing.B) {
+	peers := make([]string, 1000)
+	for i := range peers {
+		peers[i] = fmt.Sprintf("http://10.0.%d.%d:8001", i/256, i%256)
+	}
+	p := NewHTTPPool("http://localhost:8001")
+	p.Set(peers...)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				p.Set(peers...)
+			}
+		}
+	}()
+	defer close(done)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.PickPeer(strconv.Itoa(i))
+	}
+}
+
+// 模拟远程节点，记录收到的 key
+type recordPeer struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (rp *recordPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(r.URL.Path[len(defaultBasePath):], "/", 2)
+	rp.mu.Lock()
+	rp.keys = append(rp.keys, parts[1])
+	rp.mu.Unlock()
+	body, _ := proto.Marshal(&pb.Response{Value: []byte(parts[1])})
+	w.Write(body)
+}
+
+func TestLoadAll(t *testing.T) {
+	var mu sync.Mutex
+	local := make([]string, 0)
+	gee := NewGroup("loadall", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			local = append(local, key)
+			mu.Unlock()
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("loadall")
+
+	rp1, rp2 := &recordPeer{}, &recordPeer{}
+	srv1, srv2 := httptest.NewServer(rp1), httptest.NewServer(rp2)
+	defer srv1.Close()
+	defer srv2.Close()
+
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self, WithPoolLogger(NopLogger{}))
+	p.Set(self, srv1.URL, srv2.URL)
+	gee.RegisterPeers(p)
+	defer p.Close()
+
+	keys := make([]string, 30)
+	expect := map[string][]string{}
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		owner := self
+		if peer, ok := p.PickPeer(keys[i]); ok {
+			owner = strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)
+		}
+		expect[owner] = append(expect[owner], keys[i])
+	}
+
+	if err := gee.LoadAll(context.Background(), keys, 4); err != nil {
+		t.Fatal(err)
+	}
+	for owner, got := range map[string][]string{self: local, srv1.URL: rp1.keys, srv2.URL: rp2.keys} {
+		sort.Strings(got)
+		sort.Strings(expect[owner])
+		if len(got) != len(expect[owner]) || (len(got) > 0 && !reflect.DeepEqual(got, expect[owner])) {
+			t.Fatalf("expect %s to load %v, but %v got", owner, expect[owner], got)
+		}
+	}
+}
+
+func TestLoadAllCanceledWhileWaiting(t *testing.T) {
+	var loads int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	gee := NewGroup("loadall-cancel", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&loads, 1) == 1 {
+				close(entered)
+				<-release
+			}
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("loadall-cancel")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- gee.LoadAll(ctx, []string{"Tom", "Jack", "Sam"}, 1)
+	}()
+	// 第一个加载占用了唯一的并发数，等待中的 LoadAll 在取消后不再发起新的加载
+	<-entered
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, but %v got", err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("expect no loads after cancel, but %d loads got", n)
+	}
+}
+
+func TestSetSkipsSelfGetter(t *testing.T) {
+	self := "http://localhost:8001"
+	p := NewHTTPPool(self, WithPoolLogger(NopLogger{}))
+	p.Set(self, "http://localhost:8002", "http://localhost:8003")
+
+	if _, ok := p.httpGetters[self]; ok {
+		t.Fatal("expect no httpGetter for self")
+	}
+	if len(p.httpGetters) != 2 || p.PeerCount() != 3 {
+		t.Fatalf("expect 2 getters and 3 nodes, but %d, %d got", len(p.httpGetters), p.PeerCount())
+	}
+	// 本机仍然在环上，分到属于本机的 key
+	owned := 0
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, ok := p.PickPeer(key); !ok {
+			if p.peers.Get(key) != self {
+				t.Fatalf("expect %s owned by self", key)
+			}
+			owned++
+		}
+	}
+	if owned == 0 {
+		t.Fatal("expect self to own some keys")
+	}
+}
+
+func TestPickPeerWithoutPeers(t *testing.T) {
+	p := NewHTTPPool("http://localhost:8001")
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatal("expect no peer picked before Set")
+	}
+	p.Set()
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatal("expect no peer picked with empty peer list")
+	}
+
+	// 单机模式下 Group 从本地数据源加载
+	gee := NewGroup("singlenode", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("singlenode")
+	gee.RegisterPeers(NewHTTPPool("http://localhost:8001"))
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("expect Tom loaded locally, but %v got", err)
+	}
+}
+
+func TestServeContentType(t *testing.T) {
+	png := []byte("\x89PNG fake image")
+	NewGroup("contenttype", 2<<10, TypedGetterFunc(
+		func(key string) ([]byte, string, error) {
+			return png, "image/png", nil
+		}))
+	defer RemoveGroup("contenttype")
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}))
+
+	// 明确接受值的 Content-Type 的请求得到原始的值
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, defaultBasePath+"contenttype/logo", nil)
+	r.Header.Set("Accept", "image/webp, image/png")
+	p.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Fatalf("expect raw image/png, but %s %q got", ct, w.Body.Bytes())
+	}
+
+	// 节点之间仍然使用编码格式
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, defaultBasePath+"contenttype/logo", nil)
+	r.Header.Set("Accept", ProtobufCodec.ContentType())
+	p.ServeHTTP(w, r)
+	res := &pb.Response{}
+	if err := ProtobufCodec.Unmarshal(w.Body.Bytes(), res); err != nil || !bytes.Equal(res.Value, png) {
+		t.Fatalf("expect protobuf response for peers, but %q, %v got", res.Value, err)
+	}
+
+	// 不带 Accept 的旧版本节点和只接受通配符的请求得到 protobuf 响应
+	for _, accept := range []string{"", "*/*"} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, defaultBasePath+"contenttype/logo", nil)
+		r.Header.Set("Accept", accept)
+		p.ServeHTTP(w, r)
+		res = &pb.Response{}
+		if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+			t.Fatalf("accept %q: expect application/octet-stream, but %s got", accept, ct)
+		}
+		if err := ProtobufCodec.Unmarshal(w.Body.Bytes(), res); err != nil || !bytes.Equal(res.Value, png) || res.ContentType != "image/png" {
+			t.Fatalf("accept %q: expect protobuf response, but %q, %v got", accept, res.Value, err)
+		}
+	}
+
+	if v, _ := GetGroup("contenttype").Get("logo"); v.ContentType() != "image/png" {
+		t.Fatalf("expect image/png, but %s got", v.ContentType())
+	}
+	// 普通的 Getter 默认为 application/octet-stream
+	if (ByteView{b: png}).ContentType() != "application/octet-stream" {
+		t.Fatal("expect untyped value to default to application/octet-stream")
+	}
+
+	// Content-Type 随节点之间的响应传递
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient, codec: ProtobufCodec}
+	v, err := GetGroup("contenttype").getFromPeer(context.Background(), peer, "logo")
+	if err != nil || v.ContentType() != "image/png" || !bytes.Equal(v.b, png) {
+		t.Fatalf("expect image/png from peer, but %s, %v got", v.ContentType(), err)
+	}
+
+	// 没有 Content-Type 的值在不带 Accept 的请求中标记为 application/octet-stream
+	NewGroup("untyped", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	defer RemoveGroup("untyped")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"untyped/Tom", nil))
+	res = &pb.Response{}
+	if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Fatalf("expect application/octet-stream, but %s got", ct)
+	}
+	if err := ProtobufCodec.Unmarshal(w.Body.Bytes(), res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("expect protobuf body for legacy peers, but %q, %v got", res.Value, err)
+	}
+}
+
+func TestRetryFallbackPeer(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", status)
+	}))
+	defer primary.Close()
+	secondaryHits := 0
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits++
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("secondary value")})
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		w.Write(body)
+	}))
+	defer secondary.Close()
+
+	// 每个节点只有一个虚拟节点，环上的顺序为 primary、secondary、self
+	self := "http://localhost:8001"
+	positions := map[string]uint32{
+		hashtest.VirtualNode(primary.URL, 0):   1,
+		hashtest.VirtualNode(secondary.URL, 0): 2,
+		hashtest.VirtualNode(self, 0):          3,
+	}
+	p := NewHTTPPool(self, WithPoolLogger(NopLogger{}), WithReplicas(1), WithHashFunc(hashtest.Fixed(positions)))
+	p.Set(primary.URL, secondary.URL, self)
+
+	gee := NewGroup("retrypeer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local value"), nil
+		}), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("retrypeer")
+	gee.RegisterPeers(p)
+
+	// 503 可以重试，从下一个节点获取
+	if v, info, err := gee.GetWithInfo("Tom"); err != nil || v.String() != "secondary value" || info.PeerURL != secondary.URL+defaultBasePath {
+		t.Fatalf("expect value from secondary peer, but %s, %+v, %v got", v, info, err)
+	}
+
+	// 404 不重试，直接回退到本地数据源
+	status = http.StatusNotFound
+	if v, err := gee.Get("Jack"); err != nil || v.String() != "local value" || secondaryHits != 1 {
+		t.Fatalf("expect local value without retry, but %s, %v, %d secondary hits got", v, err, secondaryHits)
+	}
+}
+
+func TestHedgedRequest(t *testing.T) {
+	primaryCancelled := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(primaryCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("secondary value")})
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		w.Write(body)
+	}))
+	defer secondary.Close()
+
+	self := "http://localhost:8001"
+	positions := map[string]uint32{
+		hashtest.VirtualNode(primary.URL, 0):   1,
+		hashtest.VirtualNode(secondary.URL, 0): 2,
+		hashtest.VirtualNode(self, 0):          3,
+	}
+	p := NewHTTPPool(self, WithPoolLogger(NopLogger{}), WithReplicas(1), WithHashFunc(hashtest.Fixed(positions)))
+	p.Set(primary.URL, secondary.URL, self)
+	defer p.Close()
+
+	gee := NewGroup("hedged", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local value"), nil
+		}), WithHedging(20*time.Millisecond), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("hedged")
+	gee.RegisterPeers(p)
+
+	start := time.Now()
+	v, info, err := gee.GetWithInfo("Tom")
+	if err != nil || v.String() != "secondary value" || info.PeerURL != secondary.URL+defaultBasePath {
+		t.Fatalf("expect hedged request to secondary to win, but %s, %+v, %v got", v, info, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect hedge to cut latency, but took %v", d)
+	}
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expect slow primary request cancelled")
+	}
+}
+
+func TestPeerNotFound(t *testing.T) {
+	// 节点之间用 not_found 表示 key 不存在，与值为空区分开
+	NewGroup("servenotfound", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}))
+	defer RemoveGroup("servenotfound")
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})))
+	defer srv.Close()
+	res := &pb.Response{}
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+	if err := peer.Get(&pb.Request{Group: "servenotfound", Key: "Tom"}, res); err != nil || !res.NotFound {
+		t.Fatalf("expect not_found response, but %+v, %v got", res, err)
+	}
+
+	// 远程节点上 remote-empty 的值为空，remote-missing 不存在
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := &pb.Response{NotFound: strings.HasSuffix(r.URL.Path, "/remote-missing")}
+		body, _ := proto.Marshal(res)
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		w.Write(body)
+	}))
+	defer remote.Close()
+	gee := NewGroup("peernotfound", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local value"), nil
+		}), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("peernotfound")
+	gee.RegisterPeers(peerPicker{&httpGetter{baseURL: remote.URL + defaultBasePath, client: http.DefaultClient}})
+
+	if v, info, err := gee.GetWithInfo("remote-empty"); err != nil || v.Len() != 0 || info.Source != SourcePeer {
+		t.Fatalf("expect empty value from peer, but %q, %+v, %v got", v, info, err)
+	}
+	if v, info, err := gee.GetWithInfo("remote-missing"); err != nil || v.String() != "local value" || info.Source != SourceLocal {
+		t.Fatalf("expect fallback to local, but %q, %+v, %v got", v, info, err)
+	}
+}
+
+// peerPicker 把所有 remote 开头的 key 路由到同一个节点
+type peerPicker struct {
+	peer PeerGetter
+}
+
+func (p peerPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+func TestPeerWrites(t *testing.T) {
+	gee := NewGroup("peerwrites", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}))
+	defer RemoveGroup("peerwrites")
+	closed := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})))
+	defer closed.Close()
+	open := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}), WithPeerWrites()))
+	defer open.Close()
+
+	req := &pb.Request{Group: "peerwrites", Key: "Tom"}
+	peer := &httpGetter{baseURL: closed.URL + defaultBasePath, client: http.DefaultClient}
+	if err := peer.Set(req, []byte("630")); err == nil {
+		t.Fatal("expect peer writes rejected by default")
+	}
+	peer = &httpGetter{baseURL: open.URL + defaultBasePath, client: http.DefaultClient}
+	if err := peer.Set(req, []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := gee.GetIfPresent("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("expect value written by peer, but %s, %v got", v, ok)
+	}
+}
+
+func TestMaxPeerRequests(t *testing.T) {
+	var inFlight, maxInFlight int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			m := atomic.LoadInt64(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+				break
+			}
+		}
+		<-release
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("peer value")})
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}), WithMaxPeerRequests(2, PeerLimitWait))
+	defer p.Close()
+	p.Set(srv.URL)
+	peer, _ := p.PickPeer("Tom")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- peer.Get(&pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+		}()
+	}
+	for atomic.LoadInt64(&inFlight) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// 给排队的请求机会超过上限
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt64(&maxInFlight); n != 2 {
+		t.Fatalf("expect at most 2 concurrent requests, but %d got", n)
+	}
+
+	// 立即失败
+	block := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer slow.Close()
+	fp := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}), WithMaxPeerRequests(1, PeerLimitFailFast))
+	defer fp.Close()
+	fp.Set(slow.URL)
+	peer, _ = fp.PickPeer("Tom")
+	done := make(chan struct{})
+	go func() {
+		peer.Get(&pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+		close(done)
+	}()
+	for len(peer.(*httpGetter).sem) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := peer.Get(&pb.Request{Group: "scores", Key: "Jack"}, &pb.Response{}); err != ErrPeerBusy {
+		t.Fatalf("expect ErrPeerBusy, but %v got", err)
+	}
+	// 节点仍在列表中时沿用原来的信号量，正在进行的请求仍然计入上限
+	fp.Set(slow.URL, "http://localhost:8002")
+	if err := fp.httpGetters[slow.URL].Get(&pb.Request{Group: "scores", Key: "Jack"}, &pb.Response{}); err != ErrPeerBusy {
+		t.Fatalf("expect ErrPeerBusy after Set, but %v got", err)
+	}
+	close(block)
+	<-done
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	var written int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		chunk := make([]byte, 32<<10)
+		// 持续写入直到客户端断开，最多 256MB
+		for atomic.LoadInt64(&written) < 256<<20 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			atomic.AddInt64(&written, int64(len(chunk)))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}), WithMaxResponseBytes(1<<20))
+	defer p.Close()
+	p.Set(srv.URL)
+	peer, _ := p.PickPeer("Tom")
+	err := peer.Get(&pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expect ErrResponseTooLarge, but %v got", err)
+	}
+	if n := atomic.LoadInt64(&written); n >= 256<<20 {
+		t.Fatalf("expect read to stop early, but peer wrote %d bytes", n)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	origin := NewGroup("conditional-origin", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("630"), nil
+		}))
+	defer RemoveGroup("conditional-origin")
+	var notModified int32
+	pool := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 同一个进程中 Group 的名字唯一，把请求转给 origin
+		r.URL.Path = strings.Replace(r.URL.Path, "/conditional/", "/conditional-origin/", 1)
+		rec := httptest.NewRecorder()
+		pool.ServeHTTP(rec, r)
+		if rec.Code == http.StatusNotModified {
+			atomic.AddInt32(&notModified, 1)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+
+	// 值没有变化时返回 304，不传输值
+	req := &pb.Request{Group: "conditional-origin", Key: "remote-Tom"}
+	res := &pb.Response{}
+	if modified, err := peer.GetIfModified(context.Background(), req, []byte("630"), res); err != nil || modified || res.Value != nil {
+		t.Fatalf("expect not modified, but %v, %q, %v got", modified, res.Value, err)
+	}
+	if modified, err := peer.GetIfModified(context.Background(), req, []byte("629"), res); err != nil || !modified || string(res.Value) != "630" {
+		t.Fatalf("expect new value, but %v, %q, %v got", modified, res.Value, err)
+	}
+
+	// hotCache 中的值过期之后发出条件请求，值没有变化时继续使用旧值
+	gee := NewGroup("conditional", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("no local origin")
+		}), WithGroupLogger(NopLogger{}), WithHotCacheBytes(2<<10), WithTTL(20*time.Millisecond))
+	defer RemoveGroup("conditional")
+	gee.RegisterPeers(peerPicker{peer})
+	atomic.StoreInt32(&notModified, 0)
+
+	if v, err := gee.Get("remote-Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630 from peer, but %s, %v got", v, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	v, info, err := gee.GetWithInfo("remote-Tom")
+	if err != nil || v.String() != "630" || info.Source != SourcePeer {
+		t.Fatalf("expect 630 revalidated with peer, but %s, %+v, %v got", v, info, err)
+	}
+	if atomic.LoadInt32(&notModified) != 1 || gee.Stats.PeerNotModified.Get() != 1 {
+		t.Fatalf("expect one 304, but %d, %d got", notModified, gee.Stats.PeerNotModified.Get())
+	}
+	// 重新设置了过期时间
+	if _, ttl, err := gee.GetWithTTL("remote-Tom"); err != nil || ttl <= 0 {
+		t.Fatalf("expect fresh ttl, but %v, %v got", ttl, err)
+	}
+
+	// 值变化之后获取新值
+	origin.Set("remote-Tom", []byte("631"))
+	time.Sleep(30 * time.Millisecond)
+	if v, err := gee.Get("remote-Tom"); err != nil || v.String() != "631" {
+		t.Fatalf("expect changed value 631, but %s, %v got", v, err)
+	}
+	if atomic.LoadInt32(&notModified) != 1 {
+		t.Fatalf("expect changed value transferred, but %d 304s got", notModified)
+	}
+}
+
+func TestPeerInvalidate(t *testing.T) {
+	gee := NewGroup("peerinvalidate", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("peerinvalidate")
+	closed := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})))
+	defer closed.Close()
+	open := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}), WithPeerWrites()))
+	defer open.Close()
+
+	gee.Get("Tom")
+	req := &pb.Request{Group: "peerinvalidate", Key: "Tom"}
+	peer := &httpGetter{baseURL: closed.URL + defaultBasePath, client: http.DefaultClient}
+	if err := peer.Invalidate(req); err == nil {
+		t.Fatal("expect peer invalidation rejected by default")
+	}
+	if _, ok := gee.GetIfPresent("Tom"); !ok {
+		t.Fatal("expect Tom still cached")
+	}
+	peer = &httpGetter{baseURL: open.URL + defaultBasePath, client: http.DefaultClient}
+	if err := peer.Invalidate(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gee.GetIfPresent("Tom"); ok {
+		t.Fatal("expect Tom invalidated by peer")
+	}
+
+	// 广播时跳过本机
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}))
+	p.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	var urls []string
+	for _, peer := range p.ListPeers() {
+		urls = append(urls, peerURL(peer))
+	}
+	sort.Strings(urls)
+	if !reflect.DeepEqual(urls, []string{"http://localhost:8002" + defaultBasePath, "http://localhost:8003" + defaultBasePath}) {
+		t.Fatalf("expect peers other than self, but %v got", urls)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	// 模拟旧版本的节点，直接返回原始的值
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ProtobufCodec.ContentType())
+		w.Write([]byte{0xff, 0xff, 0xff})
+	}))
+	defer srv.Close()
+
+	req := &pb.Request{Group: "scores", Key: "Tom"}
+	peer := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+	err := peer.Get(req, &pb.Response{})
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expect DecodeError, but %v got", err)
+	}
+	if de.Peer != srv.URL+defaultBasePath || de.Group != "scores" || de.Key != "Tom" || de.Err == nil {
+		t.Fatalf("expect peer, group and key in error, but %+v got", de)
+	}
+	for _, s := range []string{srv.URL, "scores/Tom", ProtobufCodec.ContentType()} {
+		if !strings.Contains(err.Error(), s) {
+			t.Fatalf("expect %q in error, but %q got", s, err)
+		}
+	}
+
+	// 过渡期间把响应体作为值
+	p := NewHTTPPool("http://localhost:8001", WithRawBodyFallback(), WithPoolLogger(NopLogger{}))
+	p.Set(srv.URL)
+	fallback, ok := p.PickPeer("Tom")
+	if !ok {
+		t.Fatal("expect remote peer")
+	}
+	res := &pb.Response{}
+	if err := fallback.Get(req, res); err != nil || !bytes.Equal(res.Value, []byte{0xff, 0xff, 0xff}) || res.NotFound {
+		t.Fatalf("expect raw body as value, but %+v, %v got", res, err)
+	}
+}
@@ -0,0 +1,81 @@
+package jumphash
+
+// Jump Consistent Hash 算法：不需要哈希环和虚拟节点，不分配内存，
+// 但要求节点有序且用下标编号，只有删除末尾节点时迁移的 key 最少。
+// 参考 https://arxiv.org/abs/1406.2294
+
+type Hash func(data []byte) uint64
+
+type Map struct {
+	// Hash函数，将 key 映射为 64 位整数
+	hash Hash
+	// 有序的真实节点列表，下标即桶编号
+	nodes []string
+}
+
+func New(fn Hash) *Map {
+	m := &Map{
+		hash: fn,
+	}
+	if m.hash == nil {
+		m.hash = fnv64a
+	}
+	return m
+}
+
+// 添加节点，已存在的节点会被忽略，新节点追加到末尾
+func (m *Map) Add(nodes ...string) {
+	for _, node := range nodes {
+		if m.index(node) < 0 {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+}
+
+func (m *Map) Get(key string) string {
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	return m.nodes[jump(m.hash([]byte(key)), len(m.nodes))]
+}
+
+// 删除节点，保持其余节点的相对顺序
+func (m *Map) Remove(node string) {
+	if idx := m.index(node); idx >= 0 {
+		m.nodes = append(m.nodes[:idx], m.nodes[idx+1:]...)
+	}
+}
+
+func (m *Map) index(node string) int {
+	for i, n := range m.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// 根据 key 的哈希值计算所属的桶编号，范围为 [0, buckets)
+func jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// FNV-1a 64 位哈希，手动展开以避免分配
+func fnv64a(data []byte) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for _, c := range data {
+		h ^= uint64(c)
+		h *= prime64
+	}
+	return h
+}
@@ -0,0 +1,84 @@
+package jumphash
+
+import (
+	"cache/consistenthash"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	m := New(nil)
+	if m.Get("key") != "" {
+		t.Fatal("expect empty node from empty map")
+	}
+
+	m.Add("a", "b", "c", "a")
+	if len(m.nodes) != 3 {
+		t.Fatalf("expect 3 nodes, but %d got", len(m.nodes))
+	}
+
+	// 相同的 key 总是映射到相同的节点
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if m.Get(key) != m.Get(key) {
+			t.Fatalf("key %s is not stable", key)
+		}
+	}
+}
+
+func TestRemoveLast(t *testing.T) {
+	m := New(nil)
+	m.Add("a", "b", "c", "d")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = m.Get(key)
+	}
+
+	// 删除末尾节点时，只有原属于该节点的 key 会迁移
+	m.Remove("d")
+	for key, node := range before {
+		if node != "d" && m.Get(key) != node {
+			t.Fatalf("key %s moved from %s to %s", key, node, m.Get(key))
+		}
+		if m.Get(key) == "d" {
+			t.Fatalf("key %s still mapped to removed node", key)
+		}
+	}
+}
+
+// 统计各节点分到的 key 数量相对平均值的最大偏差
+func maxDeviation(get func(string) string, nodes []string, n int) float64 {
+	counts := make(map[string]int, len(nodes))
+	for i := 0; i < n; i++ {
+		counts[get("key"+strconv.Itoa(i))]++
+	}
+	mean := float64(n) / float64(len(nodes))
+	var dev float64
+	for _, node := range nodes {
+		dev = math.Max(dev, math.Abs(float64(counts[node])-mean)/mean)
+	}
+	return dev
+}
+
+func TestUniformity(t *testing.T) {
+	nodes := []string{"n0", "n1", "n2", "n3", "n4", "n5", "n6", "n7", "n8", "n9"}
+	const n = 100000
+
+	jump := New(nil)
+	jump.Add(nodes...)
+	ring := consistenthash.New(50, nil)
+	ring.Add(nodes...)
+
+	jumpDev := maxDeviation(jump.Get, nodes, n)
+	ringDev := maxDeviation(ring.Get, nodes, n)
+	t.Logf("max deviation: jump %.4f, ring %.4f", jumpDev, ringDev)
+
+	if jumpDev > 0.05 {
+		t.Fatalf("jump hash distribution too skewed: %.4f", jumpDev)
+	}
+	if jumpDev > ringDev {
+		t.Fatalf("expect jump hash (%.4f) to be at least as uniform as ring (%.4f)", jumpDev, ringDev)
+	}
+}
@@ -0,0 +1,20 @@
+package cache
+
+import "log"
+
+// Logger 用于输出 Group 和 HTTPPool 的日志，可替换为自定义的日志实现
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// 默认使用标准库 log 包输出日志
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// NopLogger 丢弃所有日志
+type NopLogger struct{}
+
+func (NopLogger) Printf(format string, v ...interface{}) {}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+)
+
+// bufLogger 记录所有日志，便于测试断言
+type bufLogger struct {
+	lines []string
+}
+
+func (l *bufLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestCustomLogger(t *testing.T) {
+	logger := &bufLogger{}
+	gee := NewGroup("logger", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithGroupLogger(logger), WithHitLog(true))
+	defer RemoveGroup("logger")
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if len(logger.lines) != 1 || logger.lines[0] != "[GeeCache] hit" {
+		t.Fatalf("expect one hit log, but %v got", logger.lines)
+	}
+
+	poolLogger := &bufLogger{}
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(poolLogger))
+	p.Set("http://localhost:8001", "http://localhost:8002")
+	p.Log("hello %s", "world")
+	if len(poolLogger.lines) != 1 || !strings.HasSuffix(poolLogger.lines[0], "hello world") {
+		t.Fatalf("expect pool log captured, but %v got", poolLogger.lines)
+	}
+}
+
+func TestHitLogDisabledByDefault(t *testing.T) {
+	logger := &bufLogger{}
+	gee := NewGroup("nohitlog", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithGroupLogger(logger))
+	defer RemoveGroup("nohitlog")
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if len(logger.lines) != 0 {
+		t.Fatalf("expect no hit log, but %v got", logger.lines)
+	}
+}
+
+func benchmarkGetHit(b *testing.B, name string, hitLog bool) {
+	gee := NewGroup(name, 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithGroupLogger(log.New(ioutil.Discard, "", log.LstdFlags)), WithHitLog(hitLog))
+	defer RemoveGroup(name)
+	gee.Get("Tom")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gee.Get("Tom")
+	}
+}
+
+func BenchmarkGetHitLogEnabled(b *testing.B)  { benchmarkGetHit(b, "bench-hitlog", true) }
+func BenchmarkGetHitLogDisabled(b *testing.B) { benchmarkGetHit(b, "bench-nohitlog", false) }
+
+func TestWarnNoPeers(t *testing.T) {
+	logger := &bufLogger{}
+	gee := NewGroup("nopeers", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithGroupLogger(logger))
+	defer RemoveGroup("nopeers")
+	if err := gee.Ready(); err != nil {
+		t.Fatalf("expect standalone group ready, but %v got", err)
+	}
+
+	// 注册了节点但忘记调用 Set
+	p := NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{}))
+	gee.RegisterPeers(p)
+	if err := gee.Ready(); err != ErrNoPeers {
+		t.Fatalf("expect ErrNoPeers, but %v got", err)
+	}
+	gee.Get("Tom")
+	gee.Get("Jack")
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "peer list is empty") {
+		t.Fatalf("expect one warning, but %v got", logger.lines)
+	}
+
+	p.Set("http://localhost:8001")
+	if err := gee.Ready(); err != nil {
+		t.Fatalf("expect ready after Set, but %v got", err)
+	}
+}
@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 // LRU 缓存，当前非线程安全
 type Cache struct {
@@ -10,11 +13,51 @@ type Cache struct {
 	cache    map[string]*list.Element
 	// 可选的方法（回调作用）
 	OnEvicted func(key string, value Value)
+	// 可选的回调，与 OnEvicted 相同，同时给出记录离开缓存的原因。
+	// 与 OnEvicted 不同，值被替换（Replaced）和 Clear 时也会调用
+	OnEvictedReason func(key string, value Value, reason Reason)
+	// 淘汰时从队尾向前比较的记录数，在其中淘汰 cost/byte 最小的记录。
+	// 为 0 或所有记录都没有设置 cost 时退化为纯 LRU
+	CostWindow int
 }
 
 type entry struct {
 	key   string
 	value Value
+	// 重新生成该值的代价，越大越不容易被淘汰
+	cost int64
+}
+
+// Reason 是记录离开缓存的原因
+type Reason int
+
+const (
+	// 超过容量被淘汰
+	Capacity Reason = iota
+	// 被显式删除
+	Deleted
+	// 过期
+	Expired
+	// 缓存被清空
+	Cleared
+	// 同一个 key 的值被新值替换
+	Replaced
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Capacity:
+		return "capacity"
+	case Deleted:
+		return "deleted"
+	case Expired:
+		return "expired"
+	case Cleared:
+		return "cleared"
+	case Replaced:
+		return "replaced"
+	}
+	return "unknown"
 }
 
 // 为了计算出需要多少字节
@@ -32,22 +75,66 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	}
 }
 
-// 添加值到缓存中
+// 添加值到缓存中。更新已有的记录时保留原来的代价（见 AddWithCost），新记录的代价为 0
 func (c *Cache) Add(key string, value Value) {
+	c.add(key, value, 0, false)
+}
+
+// 添加值到缓存中，并指定重新生成该值的代价。大于 maxBytes 的记录不会被缓存。
+// 设置了 CostWindow 时，淘汰会优先选择 cost/byte 较小的记录
+func (c *Cache) AddWithCost(key string, value Value, cost int64) {
+	c.add(key, value, cost, true)
+}
+
+// setCost 为 false 时已有的记录保留原来的代价
+func (c *Cache) add(key string, value Value, cost int64, setCost bool) {
+	// 单条记录超过 maxBytes 时无论如何都放不下，直接跳过，避免淘汰全部记录
+	if c.maxBytes != 0 && int64(len(key))+int64(value.Len()) > c.maxBytes {
+		c.RemoveWithReason(key, Capacity)
+		return
+	}
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		// (*entry) 的意思是将Value转换成 entry形式进行访问
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		old := kv.value
 		kv.value = value
+		if setCost {
+			kv.cost = cost
+		}
+		if c.OnEvictedReason != nil {
+			c.OnEvictedReason(key, old, Replaced)
+		}
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, cost})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
-		c.RemoveOldest()
+		c.evict()
+	}
+}
+
+// 从队尾的 CostWindow 个记录中淘汰 cost/byte 最小的记录，相同时淘汰最久未使用的
+func (c *Cache) evict() {
+	victim := c.ll.Back()
+	if victim == nil {
+		return
+	}
+	kv := victim.Value.(*entry)
+	// 比较 cost1/bytes1 < cost2/bytes2，转换为乘法避免除法和浮点数
+	minCost, minBytes := kv.cost, int64(len(kv.key)+kv.value.Len())+1
+	ele := victim.Prev()
+	for i := 1; i < c.CostWindow && ele != nil; i++ {
+		kv = ele.Value.(*entry)
+		bytes := int64(len(kv.key)+kv.value.Len()) + 1
+		if kv.cost*minBytes < minCost*bytes {
+			victim, minCost, minBytes = ele, kv.cost, bytes
+		}
+		ele = ele.Prev()
 	}
+	c.removeElement(victim, Capacity)
 }
 
 // 从缓存中获取值
@@ -60,21 +147,124 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 	return
 }
 
+// 没有过期时间的记录由 GetWithTTL 返回的剩余存活时间
+const NoTTL time.Duration = -1
+
+// 带有过期时间的值，过期时间为零值表示永不过期
+type Expirer interface {
+	Expire() time.Time
+}
+
+// 与 Get 相同，同时返回剩余的存活时间：值没有实现 Expirer 或过期时间为零值时为 NoTTL，
+// 已经过期时为 0。Cache 本身不会删除过期的记录，由调用方处理
+func (c *Cache) GetWithTTL(key string) (value Value, ttl time.Duration, ok bool) {
+	value, ok = c.Get(key)
+	if !ok {
+		return nil, 0, false
+	}
+	return value, TTL(value), true
+}
+
+// 返回值的剩余存活时间，规则与 GetWithTTL 相同
+func TTL(value Value) time.Duration {
+	e, ok := value.(Expirer)
+	if !ok || e.Expire().IsZero() {
+		return NoTTL
+	}
+	if ttl := time.Until(e.Expire()); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
+
 // 删除缓存
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		c.removeElement(ele, Capacity)
 	}
 }
 
-// 计算 value 的长度
+func (c *Cache) removeElement(ele *list.Element, reason Reason) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil && reason != Cleared {
+		c.OnEvicted(kv.key, kv.value)
+	}
+	if c.OnEvictedReason != nil {
+		c.OnEvictedReason(kv.key, kv.value, reason)
+	}
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	c.RemoveWithReason(key, Deleted)
+}
+
+// 删除指定的缓存并指定原因（如上层发现记录已过期时使用 Expired），会触发 OnEvicted
+func (c *Cache) RemoveWithReason(key string, reason Reason) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, reason)
+	}
+}
+
+// 清空缓存，只触发 OnEvictedReason（原因为 Cleared），不触发 OnEvicted
+func (c *Cache) Clear() {
+	for c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back(), Cleared)
+	}
+}
+
+// 返回记录数。与其他方法一样不是并发安全的，并发访问时需要与 Add/Get 使用同一把锁，
+// Group 中使用 Group.Len 或 Group.Size
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// 返回最久未使用的记录（即下一个被淘汰的记录），不会改变记录的顺序
+func (c *Cache) GetOldest() (key string, value Value, ok bool) {
+	if ele := c.ll.Back(); ele != nil {
+		kv := ele.Value.(*entry)
+		return kv.key, kv.value, true
+	}
+	return
+}
+
+// 返回最近使用的记录，不会改变记录的顺序
+func (c *Cache) GetNewest() (key string, value Value, ok bool) {
+	if ele := c.ll.Front(); ele != nil {
+		kv := ele.Value.(*entry)
+		return kv.key, kv.value, true
+	}
+	return
+}
+
+// 从最近使用到最久未使用依次遍历记录，f 返回 false 时停止遍历。
+// 遍历不会改变记录的顺序；Cache 不是并发安全的，调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value Value) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// 调整最大内存，缩小时与容量不足时一样淘汰记录（设置了 CostWindow 时考虑代价）直到满足新的上限
+// （会触发 OnEvicted），返回被淘汰的记录数。maxBytes 为 0 表示不限制
+func (c *Cache) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	evicted := 0
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.evict()
+		evicted++
+	}
+	return evicted
+}
+
+// 缓存中记录（key 和 value）占用的总字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -75,3 +76,228 @@ func Test1(t *testing.T) {
 	fmt.Println(lru.cache["key"].Value.(*entry).value)
 	fmt.Println(reflect.TypeOf(lru.cache["key"].Value.(*entry).value))
 }
+
+func TestGetOldestNewest(t *testing.T) {
+	lru := New(int64(0), nil)
+	if _, _, ok := lru.GetOldest(); ok {
+		t.Fatal("expect no oldest entry in empty cache")
+	}
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+
+	if k, v, ok := lru.GetOldest(); !ok || k != "k1" || string(v.(String)) != "v1" {
+		t.Fatalf("expect oldest k1=v1, but %s=%v got", k, v)
+	}
+	if k, v, ok := lru.GetNewest(); !ok || k != "k3" || string(v.(String)) != "v3" {
+		t.Fatalf("expect newest k3=v3, but %s=%v got", k, v)
+	}
+
+	// 查看不改变顺序
+	lru.GetOldest()
+	if k, _, _ := lru.GetOldest(); k != "k1" {
+		t.Fatalf("expect oldest k1 unchanged, but %s got", k)
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Get("k1")
+
+	keys := make([]string, 0)
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if expect := []string{"k1", "k3", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect range order %s, but %s got", expect, keys)
+	}
+
+	keys = keys[:0]
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if expect := []string{"k1", "k3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect range stopped at %s, but %s got", expect, keys)
+	}
+}
+
+func TestResize(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Add("k4", String("v4"))
+
+	if n := lru.Resize(8); n != 2 || lru.nbytes > 8 || lru.Len() != 2 {
+		t.Fatalf("expect 2 evicted and nbytes <= 8, but %d evicted and nbytes %d", n, lru.nbytes)
+	}
+	if expect := []string{"k1", "k2"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %s, but %s got", expect, keys)
+	}
+
+	if n := lru.Resize(100); n != 0 || lru.Len() != 2 {
+		t.Fatalf("expect nothing evicted when growing, but %d evicted", n)
+	}
+	lru.Add("k5", String("v5"))
+	if lru.Len() != 3 {
+		t.Fatalf("expect 3 entries after growing, but %d got", lru.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Remove("k1")
+	lru.Remove("missing")
+
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 1 || lru.nbytes != int64(len("k2v2")) {
+		t.Fatal("remove k1 failed")
+	}
+	if !reflect.DeepEqual(keys, []string{"k1"}) {
+		t.Fatalf("expect OnEvicted called for k1, but %v got", keys)
+	}
+}
+
+func TestAddWithCost(t *testing.T) {
+	lru := New(int64(len("k1v1k2v2")), nil)
+	lru.CostWindow = 2
+	lru.AddWithCost("k1", String("v1"), 100)
+	lru.AddWithCost("k2", String("v2"), 1)
+	lru.AddWithCost("k3", String("v3"), 1)
+
+	// k1 最久未使用，但代价更高，k2 先被淘汰
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatal("expect high-cost k1 to survive")
+	}
+	if _, ok := lru.Get("k2"); ok {
+		t.Fatal("expect low-cost k2 to be evicted")
+	}
+
+	// 没有设置 cost 时退化为纯 LRU
+	plain := New(int64(len("k1v1k2v2")), nil)
+	plain.CostWindow = 2
+	plain.Add("k1", String("v1"))
+	plain.Add("k2", String("v2"))
+	plain.Add("k3", String("v3"))
+	if _, ok := plain.Get("k1"); ok {
+		t.Fatal("expect k1 evicted without costs")
+	}
+
+	// Add 更新值时保留原来的代价
+	kept := New(int64(len("k1v1k2v2")), nil)
+	kept.CostWindow = 2
+	kept.AddWithCost("k1", String("v1"), 100)
+	kept.AddWithCost("k2", String("v2"), 1)
+	kept.Add("k1", String("v1"))
+	kept.Get("k2")
+	kept.Add("k3", String("v3"))
+	if _, ok := kept.Get("k1"); !ok {
+		t.Fatal("expect k1 to keep its cost after Add")
+	}
+
+	// Resize 与容量不足时一样按代价淘汰
+	resized := New(0, nil)
+	resized.CostWindow = 2
+	resized.AddWithCost("k1", String("v1"), 100)
+	resized.AddWithCost("k2", String("v2"), 1)
+	if n := resized.Resize(int64(len("k1v1"))); n != 1 {
+		t.Fatalf("expect 1 evicted, but %d got", n)
+	}
+	if _, ok := resized.Get("k1"); !ok {
+		t.Fatal("expect high-cost k1 to survive Resize")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("value2"))
+	if lru.Bytes() != int64(len("k1v1k2value2")) {
+		t.Fatalf("expect %d bytes, but %d got", len("k1v1k2value2"), lru.Bytes())
+	}
+}
+
+func TestAddOversized(t *testing.T) {
+	lru := New(int64(8), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("big", String("0123456789"))
+
+	if _, ok := lru.Get("big"); ok {
+		t.Fatal("expect oversized value not cached")
+	}
+	if lru.Len() != 2 || lru.Bytes() != 8 {
+		t.Fatalf("expect the rest of the cache to survive, but %d entries got", lru.Len())
+	}
+}
+
+func TestOnEvictedReason(t *testing.T) {
+	var reasons []string
+	lru := New(int64(10), nil)
+	lru.OnEvictedReason = func(key string, value Value, reason Reason) {
+		reasons = append(reasons, key+":"+reason.String())
+	}
+	lru.Add("k1", String("v1"))
+	lru.Add("k1", String("v2"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Remove("k2")
+	lru.Add("k4", String("v4"))
+	lru.RemoveWithReason("k4", Expired)
+	lru.Clear()
+
+	expect := []string{"k1:replaced", "k1:capacity", "k2:deleted", "k4:expired", "k3:cleared"}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, but %v got", expect, reasons)
+	}
+}
+
+// expiring 是带有过期时间的值
+type expiring struct {
+	String
+	e time.Time
+}
+
+func (v expiring) Expire() time.Time { return v.e }
+
+func TestGetWithTTL(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("plain", String("v"))
+	lru.Add("forever", expiring{String: "v"})
+	lru.Add("ttl", expiring{String: "v", e: time.Now().Add(time.Second)})
+	lru.Add("expired", expiring{String: "v", e: time.Now().Add(-time.Second)})
+
+	for _, key := range []string{"plain", "forever"} {
+		if _, ttl, ok := lru.GetWithTTL(key); !ok || ttl != NoTTL {
+			t.Fatalf("expect NoTTL for %s, but %v, %v got", key, ttl, ok)
+		}
+	}
+	if _, ttl, ok := lru.GetWithTTL("expired"); !ok || ttl != 0 {
+		t.Fatalf("expect 0 for expired value, but %v, %v got", ttl, ok)
+	}
+	if _, _, ok := lru.GetWithTTL("missing"); ok {
+		t.Fatal("expect miss")
+	}
+
+	_, first, ok := lru.GetWithTTL("ttl")
+	if !ok || first <= 900*time.Millisecond || first > time.Second {
+		t.Fatalf("expect ttl close to 1s, but %v got", first)
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, second, _ := lru.GetWithTTL("ttl")
+	if d := first - second; d < 20*time.Millisecond || d > 200*time.Millisecond {
+		t.Fatalf("expect ttl to decrease by about 20ms, but %v -> %v", first, second)
+	}
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"cache/consistenthash"
+	pb "cache/geecachepb"
+	"fmt"
+	"sync"
+)
+
+// MemoryPool 是进程内的节点集合，实现了与 HTTPPool 相同的 PeerPicker/PeerGetter，
+// 节点之间直接调用对方的 Group 而不经过网络。用于测试多节点场景，或在一个进程中运行多个节点做基准测试
+type MemoryPool struct {
+	mu sync.Mutex
+	// 所有节点共享的一致性哈希环
+	ring *consistenthash.Map
+	// 节点名到该节点上按名字查找 Group 的函数
+	nodes map[string]func(group string) *Group
+}
+
+// 实例化 MemoryPool，replicas 和 fn 与 consistenthash.New 相同
+func NewMemoryPool(replicas int, fn consistenthash.Hash) *MemoryPool {
+	return &MemoryPool{
+		ring:  consistenthash.New(replicas, fn),
+		nodes: make(map[string]func(group string) *Group),
+	}
+}
+
+// 添加节点，lookup 根据请求中的 Group 名字返回该节点上对应的 Group，不存在时返回 nil。
+// 同一个进程中 Group 的名字是全局唯一的，多个节点上的“同名”Group 需要使用不同的名字并由 lookup 映射
+func (m *MemoryPool) Add(node string, lookup func(group string) *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.nodes[node]; !ok {
+		m.ring.Add(node)
+	}
+	m.nodes[node] = lookup
+}
+
+// 返回节点 self 使用的 PeerPicker，传给该节点上的 Group.RegisterPeers
+func (m *MemoryPool) Picker(self string) PeerPicker {
+	return memoryPicker{pool: m, self: self}
+}
+
+type memoryPicker struct {
+	pool *MemoryPool
+	self string
+}
+
+// 实现 PeerCounter 接口，返回已经添加的节点数
+func (p memoryPicker) PeerCount() int {
+	p.pool.mu.Lock()
+	defer p.pool.mu.Unlock()
+	return len(p.pool.nodes)
+}
+
+// 实现 PeerLister 接口，返回除本节点以外的全部节点
+func (p memoryPicker) ListPeers() []PeerGetter {
+	p.pool.mu.Lock()
+	defer p.pool.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.pool.nodes))
+	for node := range p.pool.nodes {
+		if node != p.self {
+			peers = append(peers, memoryPeer{pool: p.pool, node: node})
+		}
+	}
+	return peers
+}
+
+// 根据 key 选择节点，属于本节点时返回 false
+func (p memoryPicker) PickPeer(key string) (PeerGetter, bool) {
+	p.pool.mu.Lock()
+	defer p.pool.mu.Unlock()
+	node := p.pool.ring.Get(key)
+	if node == "" || node == p.self {
+		return nil, false
+	}
+	return memoryPeer{pool: p.pool, node: node}, true
+}
+
+// memoryPeer 直接调用节点上的 Group
+type memoryPeer struct {
+	pool *MemoryPool
+	node string
+}
+
+func (p memoryPeer) Get(in *pb.Request, out *pb.Response) error {
+	p.pool.mu.Lock()
+	lookup := p.pool.nodes[p.node]
+	p.pool.mu.Unlock()
+	g := lookup(in.GetGroup())
+	if g == nil {
+		return fmt.Errorf("no such group on %s: %s", p.node, in.GetGroup())
+	}
+	view, err := g.Get(in.GetKey())
+	if err != nil {
+		if g.notFound(err) {
+			out.NotFound = true
+			return nil
+		}
+		return err
+	}
+	out.Value = view.ByteSlice()
+	out.ContentType = view.ct
+	return nil
+}
+
+// 实现了 PeerSetter 接口，直接写入节点上 Group 的缓存
+func (p memoryPeer) Set(in *pb.Request, value []byte) error {
+	p.pool.mu.Lock()
+	lookup := p.pool.nodes[p.node]
+	p.pool.mu.Unlock()
+	g := lookup(in.GetGroup())
+	if g == nil {
+		return fmt.Errorf("no such group on %s: %s", p.node, in.GetGroup())
+	}
+	return g.fill(in.GetKey(), value)
+}
+
+// 实现了 PeerInvalidator 接口，删除节点上 Group 的缓存
+func (p memoryPeer) Invalidate(in *pb.Request) error {
+	p.pool.mu.Lock()
+	lookup := p.pool.nodes[p.node]
+	p.pool.mu.Unlock()
+	g := lookup(in.GetGroup())
+	if g == nil {
+		return fmt.Errorf("no such group on %s: %s", p.node, in.GetGroup())
+	}
+	key := g.normalize(in.GetKey())
+	if err := g.checkKey(key); err != nil {
+		return err
+	}
+	g.invalidateLocal(key)
+	return nil
+}
+
+func (p memoryPeer) String() string {
+	return "memory://" + p.node
+}
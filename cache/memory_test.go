@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"cache/hashtest"
+	"cache/ratelimit"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryPool(t *testing.T) {
+	// 节点 a 在环上的位置为 100，节点 b 为 200
+	positions := map[string]uint32{
+		hashtest.VirtualNode("a", 0): 100,
+		hashtest.VirtualNode("b", 0): 200,
+		"Tom":                        50,  // 属于 a
+		"Jack":                       150, // 属于 b
+	}
+	pool := NewMemoryPool(1, hashtest.Fixed(positions))
+
+	loads := make(map[string][]string)
+	groups := make(map[string]*Group)
+	for _, node := range []string{"a", "b"} {
+		node := node
+		name := "memory-" + node
+		g := NewGroup(name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads[node] = append(loads[node], key)
+				return []byte(fmt.Sprintf("%s from %s", key, node)), nil
+			}))
+		defer RemoveGroup(name)
+		g.RegisterPeers(pool.Picker(node))
+		groups[node] = g
+		pool.Add(node, func(group string) *Group { return g })
+	}
+
+	// 无论从哪个节点访问，key 都由所属节点加载
+	for _, node := range []string{"a", "b"} {
+		if v, err := groups[node].Get("Tom"); err != nil || v.String() != "Tom from a" {
+			t.Fatalf("expect Tom loaded by a, but %s, %v got", v, err)
+		}
+		if v, err := groups[node].Get("Jack"); err != nil || v.String() != "Jack from b" {
+			t.Fatalf("expect Jack loaded by b, but %s, %v got", v, err)
+		}
+	}
+	if len(loads["a"]) != 1 || len(loads["b"]) != 1 {
+		t.Fatalf("expect each key loaded once by its owner, but %v got", loads)
+	}
+	if _, info, _ := groups["b"].GetWithInfo("Tom"); info.Source != SourcePeer || info.PeerURL != "memory://a" {
+		t.Fatalf("expect Tom from peer a, but %+v got", info)
+	}
+}
+
+func TestPropagateToOwner(t *testing.T) {
+	positions := map[string]uint32{
+		hashtest.VirtualNode("a", 0): 100,
+		hashtest.VirtualNode("b", 0): 200,
+		"Tom":                        50, // 属于 a
+	}
+	pool := NewMemoryPool(1, hashtest.Fixed(positions))
+
+	// a 的数据源暂时不可用，b 代为加载
+	a := NewGroup("propagate-a", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("origin unavailable")
+		}), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("propagate-a")
+	b := NewGroup("propagate-b", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("630"), nil
+		}), WithGroupLogger(NopLogger{}), WithPropagateToOwner())
+	defer RemoveGroup("propagate-b")
+	a.RegisterPeers(pool.Picker("a"))
+	b.RegisterPeers(pool.Picker("b"))
+	pool.Add("a", func(string) *Group { return a })
+	pool.Add("b", func(string) *Group { return b })
+
+	if v, info, err := b.GetWithInfo("Tom"); err != nil || v.String() != "630" || info.Source != SourceLocal {
+		t.Fatalf("expect b to load locally, but %s, %+v, %v got", v, info, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, ok := a.GetIfPresent("Tom"); ok {
+			if v.String() != "630" {
+				t.Fatalf("expect 630 propagated, but %s got", v)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect value propagated to owner a")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWarmFromPeers(t *testing.T) {
+	old := NewMemoryPool(50, nil)
+	scaled := NewMemoryPool(50, nil)
+	for _, node := range []string{"a", "b"} {
+		node := node
+		name := "warmpeers-" + node
+		g := NewGroup(name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key + " from " + node), nil
+			}))
+		defer RemoveGroup(name)
+		old.Add(node, func(string) *Group { return g })
+		scaled.Add(node, func(string) *Group { return g })
+	}
+	// 新节点 c 的数据源不可用，只能从旧节点复制
+	c := NewGroup("warmpeers-c", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("origin unavailable")
+		}), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("warmpeers-c")
+	c.RegisterPeers(scaled.Picker("c"))
+	scaled.Add("c", func(string) *Group { return c })
+
+	keys := make([]string, 100)
+	owned := 0
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		if _, ok := scaled.Picker("c").PickPeer(keys[i]); !ok {
+			owned++
+		}
+	}
+	if owned == 0 {
+		t.Fatal("expect c to own some keys")
+	}
+
+	copied, err := c.WarmFromPeers(context.Background(), old.Picker("c"), keys, ratelimit.New(10000, 10))
+	if err != nil || copied != owned {
+		t.Fatalf("expect %d keys copied, but %d, %v got", owned, copied, err)
+	}
+	if _, entries := c.Size(); entries != owned {
+		t.Fatalf("expect %d entries on c, but %d got", owned, entries)
+	}
+	for _, key := range keys {
+		if _, ok := scaled.Picker("c").PickPeer(key); ok {
+			continue
+		}
+		v, ok := c.GetIfPresent(key)
+		if !ok {
+			t.Fatalf("expect %s warmed on c", key)
+		}
+		if owner, _ := old.Picker("c").PickPeer(key); v.String() != key+" from "+owner.(memoryPeer).node {
+			t.Fatalf("expect %s copied from its previous owner, but %s got", key, v)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if copied, err := c.WarmFromPeers(ctx, old.Picker("c"), keys, nil); copied != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect cancelled warm, but %d, %v got", copied, err)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	positions := map[string]uint32{
+		hashtest.VirtualNode("a", 0): 100,
+		hashtest.VirtualNode("b", 0): 200,
+		"Tom":                        50,  // 属于 a
+		"Jack":                       150, // 属于 b
+		"Sam":                        160, // 属于 b
+	}
+	pool := NewMemoryPool(1, hashtest.Fixed(positions))
+
+	// 数据源中的值带上版本，Sam 一开始不存在
+	version := 1
+	loads := make(map[string]int)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		if key == "Sam" && version == 1 {
+			return nil, ErrNotFound
+		}
+		return []byte(key + " v" + strconv.Itoa(version)), nil
+	})
+	a := NewGroup("invalidate-a", 2<<10, getter)
+	defer RemoveGroup("invalidate-a")
+	b := NewGroup("invalidate-b", 2<<10, getter, WithHotCacheBytes(2<<10),
+		WithNegativeCache(time.Minute), WithInvalidateBroadcast())
+	defer RemoveGroup("invalidate-b")
+	a.RegisterPeers(pool.Picker("a"))
+	b.RegisterPeers(pool.Picker("b"))
+	pool.Add("a", func(string) *Group { return a })
+	pool.Add("b", func(string) *Group { return b })
+
+	// Tom 在 a 的 mainCache 和 b 的 hotCache 中，Jack 在 b 的 mainCache 中，Sam 在 b 的负缓存中
+	b.Get("Tom")
+	b.Get("Jack")
+	if _, err := b.Get("Sam"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but %v got", err)
+	}
+	if _, hot := b.HotSize(); hot != 1 {
+		t.Fatalf("expect Tom in b's hot cache, but %d entries got", hot)
+	}
+
+	version = 2
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if err := b.Invalidate(key); err != nil {
+			t.Fatalf("invalidate %s: %v", key, err)
+		}
+	}
+	if _, entries := a.Size(); entries != 0 {
+		t.Fatalf("expect Tom invalidated on a, but %d entries got", entries)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if v, err := b.Get(key); err != nil || v.String() != key+" v2" {
+			t.Fatalf("expect %s reloaded from origin, but %s, %v got", key, v, err)
+		}
+		if loads[key] != 2 {
+			t.Fatalf("expect %s loaded twice, but %d got", key, loads[key])
+		}
+	}
+}
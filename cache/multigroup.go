@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MultiGroup 是多个共享同一个节点选择器（如 HTTPPool）的 Group 的统一入口，
+// 按 Group 名字分发 Get，并汇总各 Group 的统计信息
+type MultiGroup struct {
+	peers PeerPicker
+
+	mu     sync.RWMutex
+	groups map[string]*Group
+}
+
+// 实例化 MultiGroup，peers 为 nil 时各 Group 只从本地数据源加载
+func NewMultiGroup(peers PeerPicker) *MultiGroup {
+	return &MultiGroup{
+		peers:  peers,
+		groups: make(map[string]*Group),
+	}
+}
+
+// 加入已存在的 Group，并为它注册共享的 peers。Group 不能已经调用过 RegisterPeers
+func (m *MultiGroup) Add(g *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[g.name]; ok {
+		return
+	}
+	if m.peers != nil {
+		g.RegisterPeers(m.peers)
+	}
+	m.groups[g.name] = g
+}
+
+// 通过 NewGroup 创建 Group 并加入 MultiGroup
+func (m *MultiGroup) NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g := NewGroup(name, cacheBytes, getter, opts...)
+	m.Add(g)
+	return g
+}
+
+// 返回名为 name 的 Group，不存在时返回 nil
+func (m *MultiGroup) Group(name string) *Group {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.groups[name]
+}
+
+// 返回按名字排序的全部 Group 名字
+func (m *MultiGroup) Groups() []string {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.groups))
+	for name := range m.groups {
+		names = append(names, name)
+	}
+	m.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// 从名为 group 的 Group 中获取 key 对应的值
+func (m *MultiGroup) Get(group, key string) (ByteView, error) {
+	g := m.Group(group)
+	if g == nil {
+		return ByteView{}, fmt.Errorf("no such group: %s", group)
+	}
+	return g.Get(key)
+}
+
+// 返回全部 Group 的统计信息之和
+func (m *MultiGroup) Stats() Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var s Stats
+	for _, g := range m.groups {
+		s.add(&g.Stats)
+	}
+	return s
+}
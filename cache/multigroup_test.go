@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMultiGroup(t *testing.T) {
+	m := NewMultiGroup(fakePicker{})
+	m.NewGroup("multi-a", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("a:" + key), nil
+		}))
+	defer RemoveGroup("multi-a")
+	b := NewGroup("multi-b", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("b:" + key), nil
+		}))
+	defer RemoveGroup("multi-b")
+	m.Add(b)
+
+	if v, err := m.Get("multi-a", "Tom"); err != nil || v.String() != "a:Tom" {
+		t.Fatalf("expect a:Tom, but %s, %v got", v, err)
+	}
+	if v, err := m.Get("multi-b", "Tom"); err != nil || v.String() != "b:Tom" {
+		t.Fatalf("expect b:Tom, but %s, %v got", v, err)
+	}
+	if _, err := m.Get("multi-c", "Tom"); err == nil {
+		t.Fatal("expect error for unknown group")
+	}
+
+	// 两个 Group 共享同一个节点选择器
+	for _, name := range m.Groups() {
+		if v, err := m.Get(name, "remote-Tom"); err != nil || v.String() != "peer value" {
+			t.Fatalf("expect %s to load from shared peer, but %s, %v got", name, v, err)
+		}
+		if m.Group(name).peers != (fakePicker{}) {
+			t.Fatalf("expect %s registered with shared peers", name)
+		}
+	}
+}
+
+func TestMultiGroupStatsAllFields(t *testing.T) {
+	m := NewMultiGroup(fakePicker{})
+	for _, name := range []string{"multistats-a", "multistats-b"} {
+		g := m.NewGroup(name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}))
+		defer RemoveGroup(name)
+		// 每个字段设置不同的值
+		v := reflect.ValueOf(&g.Stats).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			v.Field(i).Addr().Interface().(*AtomicInt).Add(int64(i + 1))
+		}
+	}
+
+	s := m.Stats()
+	v := reflect.ValueOf(&s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if n := v.Field(i).Addr().Interface().(*AtomicInt).Get(); n != int64(2*(i+1)) {
+			t.Fatalf("expect %s summed to %d, but %d got", v.Type().Field(i).Name, 2*(i+1), n)
+		}
+	}
+}
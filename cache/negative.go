@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"cache/lru"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 负缓存：记录数据源中不存在的 key（或 ttlFunc 选择的错误），在 ttl 内再次访问时直接返回原来的错误，不再访问数据源
+type negativeCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache
+	// 最大字节数，0 表示不限制
+	maxBytes int64
+	ttl      time.Duration
+	// 根据错误返回记录的存活时间，0 表示不记录。不为 nil 时代替 ttl，所有错误都会经过它
+	ttlFunc func(err error) time.Duration
+}
+
+// 负缓存的记录，Len 用于计算占用的字节数
+type negativeEntry struct {
+	err    error
+	expire time.Time
+}
+
+func (e negativeEntry) Len() int {
+	return len(e.err.Error())
+}
+
+// 返回数据源的错误在负缓存中的存活时间，0 表示不记录。
+// 没有设置 ttlFunc 时只记录 notFound 判断为不存在的错误
+func (c *negativeCache) ttlFor(err error, notFound func(error) bool) time.Duration {
+	if c.ttlFunc != nil {
+		return c.ttlFunc(err)
+	}
+	if notFound(err) {
+		return c.ttl
+	}
+	return 0
+}
+
+// 记录 key 的错误，ttl 之后过期
+func (c *negativeCache) add(key string, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		c.lru = lru.New(c.maxBytes, nil)
+	}
+	c.lru.Add(key, negativeEntry{err: err, expire: time.Now().Add(ttl)})
+}
+
+// 返回 key 不存在时记录的错误，没有记录或已过期时返回 nil
+func (c *negativeCache) get(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return nil
+	}
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return nil
+	}
+	e := v.(negativeEntry)
+	if time.Now().After(e.expire) {
+		c.lru.Remove(key)
+		return nil
+	}
+	return e.err
+}
+
+// 删除 key 的记录，key 被写入之后调用
+func (c *negativeCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru != nil {
+		c.lru.Remove(key)
+	}
+}
+
+// 默认的 NotFound 判断：错误链中包含 ErrNotFound
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
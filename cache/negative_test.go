@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	errTransient := errors.New("connection refused")
+	loads := make(map[string]int)
+	gee := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			switch key {
+			case "missing":
+				return nil, fmt.Errorf("query %s: %w", key, ErrNotFound)
+			case "down":
+				return nil, errTransient
+			}
+			return []byte(key), nil
+		}), WithNegativeCache(time.Minute), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("negative")
+
+	// 不存在的 key 只访问一次数据源，之后返回相同的错误
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, but %v got", err)
+		}
+	}
+	if loads["missing"] != 1 {
+		t.Fatalf("expect not-found cached, but %d loads got", loads["missing"])
+	}
+	// 负缓存命中不是缓存命中
+	if _, info, err := gee.GetWithInfo("missing"); !errors.Is(err, ErrNotFound) || info != (Info{}) {
+		t.Fatalf("expect zero Info for a negative hit, but %+v, %v got", info, err)
+	}
+
+	// 暂时性的错误不被缓存
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("down"); err != errTransient {
+			t.Fatalf("expect transient error, but %v got", err)
+		}
+	}
+	if loads["down"] != 3 {
+		t.Fatalf("expect transient error not cached, but %d loads got", loads["down"])
+	}
+
+	// 写入之后不再返回不存在
+	gee.Set("missing", []byte("now exists"))
+	if v, err := gee.Get("missing"); err != nil || v.String() != "now exists" {
+		t.Fatalf("expect value after Set, but %s, %v got", v, err)
+	}
+}
+
+func TestWithNotFound(t *testing.T) {
+	errNoRows := errors.New("no rows in result set")
+	loads := 0
+	gee := NewGroup("notfoundhook", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, errNoRows
+		}), WithNegativeCache(time.Minute), WithNotFound(func(err error) bool {
+		return err == errNoRows
+	}))
+	defer RemoveGroup("notfoundhook")
+
+	gee.Get("Tom")
+	if _, err := gee.Get("Tom"); err != errNoRows || loads != 1 {
+		t.Fatalf("expect custom not-found error cached, but %v, %d loads got", err, loads)
+	}
+}
+
+func TestNegativeCacheFunc(t *testing.T) {
+	errTimeout := errors.New("origin timeout")
+	errDenied := errors.New("permission denied")
+	loads := make(map[string]int)
+	gee := NewGroup("negativefunc", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			switch key {
+			case "missing":
+				return nil, ErrNotFound
+			case "slow":
+				return nil, errTimeout
+			}
+			return nil, errDenied
+		}), WithGroupLogger(NopLogger{}), WithNegativeCacheFunc(func(err error) time.Duration {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return time.Minute
+		case err == errTimeout:
+			return 20 * time.Millisecond
+		}
+		return 0
+	}))
+	defer RemoveGroup("negativefunc")
+
+	get := func(key string, times int) {
+		for i := 0; i < times; i++ {
+			gee.Get(key)
+		}
+	}
+	get("missing", 3)
+	get("slow", 3)
+	get("denied", 3)
+	if loads["missing"] != 1 || loads["slow"] != 1 || loads["denied"] != 3 {
+		t.Fatalf("expect per-error negative caching, but %v got", loads)
+	}
+
+	// 超时只缓存很短的时间，不存在仍然被缓存
+	time.Sleep(30 * time.Millisecond)
+	get("missing", 1)
+	if _, err := gee.Get("slow"); err != errTimeout {
+		t.Fatalf("expect timeout error, but %v got", err)
+	}
+	if loads["missing"] != 1 || loads["slow"] != 2 {
+		t.Fatalf("expect only the timeout to expire, but %v got", loads)
+	}
+}
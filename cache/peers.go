@@ -1,6 +1,10 @@
 package cache
 
-import pb "cache/geecachepb"
+import (
+	pb "cache/geecachepb"
+	"context"
+	"fmt"
+)
 
 // PeerPicker 是一个节点用来获取自己的 key 的接口
 type PeerPicker interface {
@@ -8,8 +12,84 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// RingWatcher 由节点信息会发生变化的 PeerPicker 实现（如 HTTPPool），
+// Group 在 RegisterPeers 时通过它注册回调，在节点变化后清理不再属于本机的缓存
+type RingWatcher interface {
+	// 注册节点变化之后调用的回调，返回的函数取消注册，可以多次调用
+	OnRingChange(fn func()) (unregister func())
+}
+
+// FallbackPicker 由可以在首选节点失败后选择下一个节点的 PeerPicker 实现（如 HTTPPool），
+// 首选节点返回可重试的错误时，Group 会先尝试该节点再回退到本地数据源
+type FallbackPicker interface {
+	// 返回 key 的下一个候选节点，下一个候选节点是本机或不存在时 ok 为 false
+	PickFallbackPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// PeerCounter 由可以报告当前节点数的 PeerPicker 实现（如 HTTPPool），
+// Group 用它发现注册了节点但节点列表为空（实际以单机模式运行）的配置错误
+type PeerCounter interface {
+	// 返回节点数（包括本机），没有设置节点时为 0
+	PeerCount() int
+}
+
 // PeerGetter 是一个节点用来获取远程节点的 key 的接口
 type PeerGetter interface {
 	// 从对应 group 中查找缓存值,使用 protobuf 进行通信
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// PeerSetter 由可以把值写入远程节点缓存的 PeerGetter 实现（如 httpGetter），
+// 用于把本机代为加载的值推送给所属节点，见 WithPropagateToOwner
+type PeerSetter interface {
+	Set(in *pb.Request, value []byte) error
+}
+
+// PeerInvalidator 由可以删除远程节点缓存的 PeerGetter 实现（如 httpGetter），见 WithInvalidateBroadcast
+type PeerInvalidator interface {
+	Invalidate(in *pb.Request) error
+}
+
+// PeerLister 由可以列出全部远程节点的 PeerPicker 实现（如 HTTPPool），用于向所有节点广播
+type PeerLister interface {
+	// 返回除本机以外的全部节点
+	ListPeers() []PeerGetter
+}
+
+// ContextPeerGetter 由可以取消请求的 PeerGetter 实现（如 httpGetter），
+// Group 在取消对冲请求等场景下使用
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// ConditionalPeerGetter 由支持条件请求的 PeerGetter 实现（如 httpGetter），
+// Group 重新获取 hotCache 中已经过期的值时带上旧值，远程节点的值没有变化时不再传输整个值
+type ConditionalPeerGetter interface {
+	// cached 是本机已有的旧值。远程节点的值与 cached 相同时返回 false 且不修改 out，
+	// 否则与 GetContext 相同并返回 true
+	GetIfModified(ctx context.Context, in *pb.Request, cached []byte, out *pb.Response) (modified bool, err error)
+}
+
+// Ring 是 HTTPPool 根据 key 选择节点的算法，默认为 consistenthash.Map
+type Ring interface {
+	// 添加节点
+	Add(nodes ...string)
+	// 删除节点
+	Remove(node string)
+	// 根据 key 返回对应的节点，没有节点时返回空字符串
+	Get(key string) string
+}
+
+// MultiRing 由可以按顺序返回多个候选节点的 Ring 实现（如 consistenthash.Map）
+type MultiRing interface {
+	// 返回 key 的最多 n 个不同的候选节点，第一个与 Get 的结果相同
+	GetN(key string, n int) []string
+}
+
+// 返回节点的地址，PeerGetter 实现了 fmt.Stringer 时使用其 String 方法
+func peerURL(peer PeerGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return ""
+}
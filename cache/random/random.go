@@ -0,0 +1,107 @@
+package random
+
+import (
+	"cache/lru"
+	"math/rand"
+)
+
+// 随机淘汰缓存：超出容量时等概率淘汰任意一条记录。用作对比其他淘汰算法的基准，当前非线程安全
+type Cache struct {
+	maxBytes int64
+	nbytes   int64
+	// 全部记录，用于 O(1) 随机选择
+	entries []*entry
+	// key 到 entries 下标的映射
+	cache map[string]int
+	// 随机数来源，便于测试时固定种子
+	rand *rand.Rand
+	// 可选的方法（回调作用）
+	OnEvicted func(key string, value lru.Value)
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]int),
+		rand:      rand.New(rand.NewSource(rand.Int63())),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 添加值到缓存中
+func (c *Cache) Add(key string, value lru.Value) {
+	if idx, ok := c.cache[key]; ok {
+		kv := c.entries[idx]
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+	} else {
+		c.cache[key] = len(c.entries)
+		c.entries = append(c.entries, &entry{key, value})
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// 从缓存中获取值
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if idx, ok := c.cache[key]; ok {
+		return c.entries[idx].value, true
+	}
+	return
+}
+
+// 随机淘汰一条记录，名字与 lru.Cache 保持一致
+func (c *Cache) RemoveOldest() {
+	if len(c.entries) > 0 {
+		c.removeAt(c.rand.Intn(len(c.entries)))
+	}
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if idx, ok := c.cache[key]; ok {
+		c.removeAt(idx)
+	}
+}
+
+// 遍历全部记录（顺序不固定），f 返回 false 时停止。
+// 调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value lru.Value) bool) {
+	for _, kv := range c.entries {
+		if !f(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
+// 缓存中的记录数
+func (c *Cache) Len() int {
+	return len(c.entries)
+}
+
+// 将最后一条记录移动到被删除的位置，保持 entries 紧凑
+func (c *Cache) removeAt(idx int) {
+	kv := c.entries[idx]
+	last := len(c.entries) - 1
+	c.entries[idx] = c.entries[last]
+	c.cache[c.entries[idx].key] = idx
+	c.entries[last] = nil
+	c.entries = c.entries[:last]
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 缓存中记录（key 和 value）占用的总字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
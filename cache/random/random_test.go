@@ -0,0 +1,36 @@
+package random
+
+import (
+	"fmt"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestBoundedSize(t *testing.T) {
+	// 每条记录 6 字节，最多 10 条
+	c := New(int64(60), nil)
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("%05d", i), String("v"))
+		if c.nbytes > 60 {
+			t.Fatalf("expect nbytes <= 60, but %d got", c.nbytes)
+		}
+	}
+	if c.Len() != 10 || len(c.cache) != 10 {
+		t.Fatalf("expect 10 entries, but %d got", c.Len())
+	}
+	for key, idx := range c.cache {
+		if c.entries[idx].key != key {
+			t.Fatalf("index of %s is inconsistent", key)
+		}
+	}
+
+	c.Remove(c.entries[0].key)
+	if c.Len() != 9 || c.nbytes != 54 {
+		t.Fatalf("expect 9 entries after remove, but %d got", c.Len())
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter 是并发安全的令牌桶：以 rate 个/秒的速度生成令牌，最多存放 burst 个
+type Limiter struct {
+	mu sync.Mutex
+	// 每秒生成的令牌数
+	rate float64
+	// 桶的容量
+	burst float64
+	// 当前令牌数
+	tokens float64
+	// 上次更新令牌数的时间
+	last time.Time
+	// 获取当前时间，便于测试时替换
+	now func() time.Time
+}
+
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// 尝试获取一个令牌，没有令牌时返回 false
+func (l *Limiter) Allow() bool {
+	ok, _ := l.reserve()
+	return ok
+}
+
+// 等待直到获取一个令牌，ctx 取消时返回 ctx.Err()
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		ok, wait := l.reserve()
+		if ok {
+			return nil
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// 尝试获取一个令牌，没有令牌时返回还需要等待多久才会生成下一个令牌
+func (l *Limiter) reserve() (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		if l.rate <= 0 {
+			// 不再生成令牌，只能等待 ctx 取消
+			return false, time.Hour
+		}
+		return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens--
+	return true, 0
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("expect burst request %d allowed", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("expect request rejected after burst")
+	}
+
+	// 0.5 秒生成 1 个令牌
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow() || l.Allow() {
+		t.Fatal("expect exactly one token after 500ms")
+	}
+
+	// 令牌数不超过 burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !l.Allow() {
+			t.Fatalf("expect request %d allowed after refill", i)
+		}
+	}
+	if l.Allow() {
+		t.Fatal("expect tokens capped at burst")
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(100, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第一个令牌立即获取，之后每 10ms 生成一个
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Fatalf("expect Wait to block for new tokens, but took %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := New(0, 1).Wait(ctx); err != nil {
+		t.Fatalf("expect token from burst, but %v got", err)
+	}
+	l = New(0, 1)
+	l.Allow()
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, but %v got", err)
+	}
+}
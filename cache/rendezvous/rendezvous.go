@@ -0,0 +1,74 @@
+package rendezvous
+
+// Rendezvous（HRW，最高随机权重）哈希：对每个节点计算 hash(node+key)，
+// 选择哈希值最大的节点。不需要虚拟节点，增删节点时只有相关节点上的 key 会迁移。
+
+type Map struct {
+	// 真实节点列表
+	nodes []string
+}
+
+func New() *Map {
+	return &Map{}
+}
+
+// 添加节点，已存在的节点会被忽略
+func (m *Map) Add(nodes ...string) {
+	for _, node := range nodes {
+		if m.index(node) < 0 {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+}
+
+func (m *Map) Remove(node string) {
+	if idx := m.index(node); idx >= 0 {
+		m.nodes = append(m.nodes[:idx], m.nodes[idx+1:]...)
+	}
+}
+
+// 返回 hash(node+key) 最大的节点，哈希值相同时取字典序较小的节点
+func (m *Map) Get(key string) string {
+	var best string
+	var max uint64
+	for i, node := range m.nodes {
+		h := hash(node, key)
+		if i == 0 || h > max || (h == max && node < best) {
+			best, max = node, h
+		}
+	}
+	return best
+}
+
+func (m *Map) index(node string) int {
+	for i, n := range m.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// 对 node+key 计算 FNV-1a 64 位哈希，并做一次混淆让结果分布更均匀
+func hash(node, key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(node); i++ {
+		h ^= uint64(node[i])
+		h *= prime64
+	}
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	// splitmix64 的收尾步骤
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,46 @@
+package rendezvous
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	m := New()
+	if m.Get("key") != "" {
+		t.Fatal("expect empty node from empty map")
+	}
+
+	m.Add("a", "b", "c")
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if counts[node] < 800 {
+			t.Fatalf("node %s got too few keys: %v", node, counts)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := New()
+	m.Add("a", "b", "c", "d")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = m.Get(key)
+	}
+
+	// 删除任意一个节点，只有原属于该节点的 key 会迁移
+	m.Remove("b")
+	for key, node := range before {
+		got := m.Get(key)
+		if node != "b" && got != node {
+			t.Fatalf("key %s moved from %s to %s", key, node, got)
+		}
+		if got == "b" {
+			t.Fatalf("key %s still mapped to removed node", key)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package singleflight
+
+import "sort"
+
+// 每个 Group 最多记录的热点 key 数
+const hotKeysCap = 64
+
+// KeyStat 是一个 key 被合并的累计次数
+type KeyStat struct {
+	Key string
+	// 加入该 key 正在进行中的请求的调用方累计数
+	Coalesced int64
+}
+
+// hotKeys 使用 space-saving 算法在固定内存内记录合并次数最多的 key：
+// 记录已满时新 key 替换次数最少的 key 并继承它的次数，热点 key 不会被大量冷 key 挤出
+type hotKeys struct {
+	counts map[string]int64
+}
+
+func (h *hotKeys) add(key string, n int64) {
+	if h.counts == nil {
+		h.counts = make(map[string]int64)
+	}
+	if _, ok := h.counts[key]; ok || len(h.counts) < hotKeysCap {
+		h.counts[key] += n
+		return
+	}
+	minKey, min := "", int64(-1)
+	for k, c := range h.counts {
+		if min < 0 || c < min {
+			minKey, min = k, c
+		}
+	}
+	delete(h.counts, minKey)
+	h.counts[key] = min + n
+}
+
+func (h *hotKeys) stats() []KeyStat {
+	stats := make([]KeyStat, 0, len(h.counts))
+	for k, c := range h.counts {
+		stats = append(stats, KeyStat{Key: k, Coalesced: c})
+	}
+	return stats
+}
+
+// 按合并次数从多到少排序并返回前 n 个，次数相同时按 key 排序
+func topKeys(stats []KeyStat, n int) []KeyStat {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Coalesced != stats[j].Coalesced {
+			return stats[i].Coalesced > stats[j].Coalesced
+		}
+		return stats[i].Key < stats[j].Key
+	})
+	if n >= 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
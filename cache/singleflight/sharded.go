@@ -0,0 +1,79 @@
+package singleflight
+
+import "hash/fnv"
+
+// Hash 将 key 映射为选择分片使用的哈希值
+type Hash func(data []byte) uint32
+
+// ShardedGroup 把 key 按哈希分到 N 个 Group 中，每个 Group 有独立的锁，
+// 大量不同的 key 并发时减少锁竞争。相同的 key 总是落在同一个 Group 中，合并语义与 Group 相同
+type ShardedGroup struct {
+	shards []Group
+	hash   Hash
+}
+
+// 实例化 ShardedGroup，n 小于 1 时为 1
+func NewSharded(n int) *ShardedGroup {
+	return NewShardedWithHash(n, nil)
+}
+
+// 与 NewSharded 相同，使用 fn 选择分片，为 nil 时使用 fnv-1a。
+// 结构化的 key（如 "user:123"）在默认哈希下分布不均时，可以换用更适合 key 格式的哈希
+func NewShardedWithHash(n int, fn Hash) *ShardedGroup {
+	if n < 1 {
+		n = 1
+	}
+	if fn == nil {
+		fn = fnv32a
+	}
+	return &ShardedGroup{shards: make([]Group, n), hash: fn}
+}
+
+func fnv32a(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+func (s *ShardedGroup) shard(key string) *Group {
+	return &s.shards[s.shardIndex(key)]
+}
+
+func (s *ShardedGroup) shardIndex(key string) int {
+	return int(s.hash([]byte(key)) % uint32(len(s.shards)))
+}
+
+// 与 Group.Do 相同
+func (s *ShardedGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return s.shard(key).Do(key, fn)
+}
+
+// 与 Group.DoChan 相同
+func (s *ShardedGroup) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	return s.shard(key).DoChan(key, fn)
+}
+
+// 与 Group.Forget 相同
+func (s *ShardedGroup) Forget(key string) {
+	s.shard(key).Forget(key)
+}
+
+// 返回所有分片的统计信息之和
+func (s *ShardedGroup) Stats() Stats {
+	var total Stats
+	for i := range s.shards {
+		st := s.shards[i].Stats()
+		total.InFlight += st.InFlight
+		total.Coalesced += st.Coalesced
+	}
+	return total
+}
+
+// 返回所有分片中被合并次数最多的最多 n 个 key，与 Group.HotKeys 相同
+func (s *ShardedGroup) HotKeys(n int) []KeyStat {
+	var stats []KeyStat
+	for i := range s.shards {
+		stats = append(stats, s.shards[i].HotKeys(-1)...)
+	}
+	return topKeys(stats, n)
+}
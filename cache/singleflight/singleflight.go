@@ -1,6 +1,9 @@
 package singleflight
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
 // call 代表正在进行中或已经结束的请求
 type call struct {
@@ -8,12 +11,53 @@ type call struct {
 	wg  sync.WaitGroup
 	val interface{}
 	err error
+	// 加入该请求的调用方数，受 Group.mu 保护
+	dups int
+	// 通过 DoChan 等待结果的调用方，受 Group.mu 保护
+	chans []chan<- Result
+}
+
+// Result 是 DoChan 返回的结果
+type Result struct {
+	Val interface{}
+	Err error
+	// 是否与其他调用方共享了这次调用的结果
+	Shared bool
 }
 
 // 管理不同 key 的请求（call）
 type Group struct {
 	mu sync.Mutex       // 保护 m 不被并发读写
 	m  map[string]*call // 懒初始化，提高内存的使用效率
+	// 加入已有请求、没有调用 fn 的 Do 的累计次数
+	coalesced int64
+	// 合并次数最多的 key，受 mu 保护
+	hot hotKeys
+}
+
+// Stats 是 Group 的统计信息
+type Stats struct {
+	// 正在进行中的请求（不同 key）数
+	InFlight int
+	// 加入已有请求而没有调用 fn 的累计次数，即 singleflight 节省的调用次数
+	Coalesced int64
+}
+
+// 返回当前的统计信息
+func (g *Group) Stats() Stats {
+	g.mu.Lock()
+	inFlight := len(g.m)
+	g.mu.Unlock()
+	return Stats{InFlight: inFlight, Coalesced: atomic.LoadInt64(&g.coalesced)}
+}
+
+// 返回被合并次数最多的最多 n 个 key（n < 0 时全部返回），按次数从多到少排序，用于发现热点 key。
+// 只记录已经结束的请求；最多记录固定数量的 key，次数是近似值，热点 key 的次数不会被低估
+func (g *Group) HotKeys(n int) []KeyStat {
+	g.mu.Lock()
+	stats := g.hot.stats()
+	g.mu.Unlock()
+	return topKeys(stats, n)
 }
 
 // 针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，
@@ -29,8 +73,10 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	}
 	// 获取call
 	if c, ok := g.m[key]; ok {
+		c.dups++
 		// 能获取到值就可以解锁
 		g.mu.Unlock()
+		atomic.AddInt64(&g.coalesced, 1)
 		// 如果请求正在进行中，则阻塞至等待组的值为0
 		c.wg.Wait()
 		// 直接返回结果
@@ -44,16 +90,61 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	// g.m 没有并发读写问题了就可以解锁
 	g.mu.Unlock()
 
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
+
+// 与 Do 相同，但不阻塞，结果在 fn 返回之后写入返回的 channel
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		atomic.AddInt64(&g.coalesced, 1)
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// 调用 fn 并通知所有等待的调用方
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
 	// 调用 fn，发起请求，这时其他请求都会进入 if 判断中去等待
 	c.val, c.err = fn()
 	// 请求结束让等待组减一
 	c.wg.Done()
 	// 加锁解决并发读写问题
 	g.mu.Lock()
-	// 删掉数据，不需要一直保存，仅是为了解决缓存击穿的问题
-	delete(g.m, key)
+	// 删掉数据，不需要一直保存，仅是为了解决缓存击穿的问题。
+	// 调用过 Forget 时 key 可能已经对应新的请求
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	chans, shared := c.chans, c.dups > 0
+	if shared {
+		g.hot.add(key, int64(c.dups))
+	}
 	// 删完数据解锁
 	g.mu.Unlock()
 
-	return c.val, c.err
+	for _, ch := range chans {
+		ch <- Result{c.val, c.err, shared}
+	}
+}
+
+// 忘记 key 正在进行中的请求，之后的 Do 会重新调用 fn，而不是等待已有的请求
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
 }
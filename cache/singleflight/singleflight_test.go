@@ -1,7 +1,12 @@
 package singleflight
 
 import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
@@ -14,3 +19,211 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v, error = %v", v, err)
 	}
 }
+
+func TestStats(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", nil
+		})
+	}()
+	<-started
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Do("key", func() (interface{}, error) {
+				t.Error("fn should not be called for coalesced calls")
+				return nil, nil
+			})
+		}()
+	}
+	// 等待 5 个调用都加入进行中的请求
+	for g.Stats().Coalesced < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := g.Stats(); s.InFlight != 1 {
+		t.Fatalf("expect 1 call in flight, but %+v got", s)
+	}
+	close(release)
+	wg.Wait()
+	if s := g.Stats(); s.InFlight != 0 || s.Coalesced != 5 {
+		t.Fatalf("expect 0 in flight and 5 coalesced, but %+v got", s)
+	}
+}
+
+func TestDoChanAndForget(t *testing.T) {
+	for name, g := range map[string]interface {
+		Do(string, func() (interface{}, error)) (interface{}, error)
+		DoChan(string, func() (interface{}, error)) <-chan Result
+		Forget(string)
+	}{"single": &Group{}, "sharded": NewSharded(8)} {
+		release := make(chan struct{})
+		calls := 0
+		fn := func() (interface{}, error) {
+			calls++
+			<-release
+			return "bar", nil
+		}
+		ch1 := g.DoChan("key", fn)
+		ch2 := g.DoChan("key", fn)
+		close(release)
+		r1, r2 := <-ch1, <-ch2
+		if r1.Val != "bar" || r2.Val != "bar" || !r1.Shared || calls != 1 {
+			t.Fatalf("%s: expect one shared call, but %+v, %+v, %d calls got", name, r1, r2, calls)
+		}
+
+		// Forget 之后的 Do 不再等待进行中的请求
+		block := make(chan struct{})
+		ch := g.DoChan("key", func() (interface{}, error) {
+			<-block
+			return "old", nil
+		})
+		g.Forget("key")
+		if v, _ := g.Do("key", func() (interface{}, error) { return "new", nil }); v != "new" {
+			t.Fatalf("%s: expect new call after Forget, but %v got", name, v)
+		}
+		close(block)
+		if r := <-ch; r.Val != "old" {
+			t.Fatalf("%s: expect old result, but %v got", name, r.Val)
+		}
+	}
+}
+
+func benchmarkDo(b *testing.B, do func(string, func() (interface{}, error)) (interface{}, error)) {
+	fn := func() (interface{}, error) { return nil, nil }
+	var n int64
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&n, 1) << 32
+		for pb.Next() {
+			i++
+			do(strconv.FormatInt(i, 10), fn)
+		}
+	})
+}
+
+func BenchmarkDoDistinctKeys(b *testing.B) {
+	benchmarkDo(b, (&Group{}).Do)
+}
+
+func BenchmarkShardedDoDistinctKeys(b *testing.B) {
+	benchmarkDo(b, NewSharded(32).Do)
+}
+
+// 返回各分片分到的 key 数的最大值与最小值之差
+func shardSpread(s *ShardedGroup, keys []string) int {
+	counts := make([]int, len(s.shards))
+	for _, key := range keys {
+		counts[s.shardIndex(key)]++
+	}
+	min, max := counts[0], counts[0]
+	for _, n := range counts {
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max - min
+}
+
+func TestShardHash(t *testing.T) {
+	keys := make([]string, 1600)
+	for i := range keys {
+		keys[i] = "user:" + strconv.Itoa(i)
+	}
+	// 按 key 中的 id 分片，连续的 id 均匀分布
+	byID := func(data []byte) uint32 {
+		id, _ := strconv.Atoi(strings.TrimPrefix(string(data), "user:"))
+		return uint32(id)
+	}
+	def, custom := NewSharded(16), NewShardedWithHash(16, byID)
+	if spread := shardSpread(custom, keys); spread != 0 {
+		t.Fatalf("expect perfectly balanced shards, but spread %d got", spread)
+	}
+	if def, custom := shardSpread(def, keys), shardSpread(custom, keys); custom >= def {
+		t.Fatalf("expect custom hash to balance better than fnv, but %d >= %d", custom, def)
+	}
+
+	// 相同的 key 仍然合并
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			custom.Do("user:1", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return nil, nil
+			})
+		}()
+	}
+	for custom.Stats().Coalesced < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expect 1 call, but %d got", calls)
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	for name, g := range map[string]interface {
+		Do(key string, fn func() (interface{}, error)) (interface{}, error)
+		Stats() Stats
+		HotKeys(n int) []KeyStat
+	}{"single": &Group{}, "sharded": NewSharded(8)} {
+		// hot 有 10 个调用方同时等待，其他 key 各 1 个调用方
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.Do("hot", func() (interface{}, error) {
+					<-release
+					return nil, nil
+				})
+			}()
+		}
+		for g.Stats().Coalesced < 9 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+		// 大量没有合并的冷 key 不会被记录
+		for i := 0; i < 200; i++ {
+			g.Do("cold"+strconv.Itoa(i), func() (interface{}, error) { return nil, nil })
+		}
+
+		top := g.HotKeys(3)
+		if len(top) != 1 || top[0] != (KeyStat{Key: "hot", Coalesced: 9}) {
+			t.Fatalf("%s: expect hot with 9 coalesced callers, but %v got", name, top)
+		}
+	}
+
+	// 记录已满时热点 key 不会被挤出
+	var h hotKeys
+	h.add("hot", 100)
+	for i := 0; i < 1000; i++ {
+		h.add("key"+strconv.Itoa(i), 1)
+	}
+	if len(h.counts) != hotKeysCap {
+		t.Fatalf("expect %d tracked keys, but %d got", hotKeysCap, len(h.counts))
+	}
+	if top := topKeys(h.stats(), 1); top[0].Key != "hot" || top[0].Coalesced != 100 {
+		t.Fatalf("expect hot to stay on top, but %v got", top)
+	}
+}
@@ -0,0 +1,69 @@
+package source
+
+import (
+	"cache"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileGetter 从本地文件系统读取源数据
+type fileGetter struct {
+	// 根目录解析符号链接之后的绝对路径
+	root string
+}
+
+// 返回一个从本地文件系统读取源数据的 Getter：key 是 rootDir 下以 "/" 分隔的相对路径，返回文件内容。
+// 文件不存在时返回 cache.ErrNotFound。key 为绝对路径、包含 ".." 或通过符号链接指向 rootDir 之外时
+// 返回包装了 cache.ErrInvalidKey 的错误，不会读取 rootDir 之外的文件
+func FileGetter(rootDir string) cache.Getter {
+	root, err := filepath.Abs(rootDir)
+	if err == nil {
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+	}
+	return &fileGetter{root: filepath.Clean(root)}
+}
+
+func (f *fileGetter) Get(key string) ([]byte, error) {
+	name, err := f.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, cache.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+// 将 key 转换为根目录下的文件路径，拒绝访问根目录之外的文件
+func (f *fileGetter) resolve(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") || filepath.VolumeName(key) != "" {
+		return "", fmt.Errorf("%w: %q", cache.ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %q escapes root", cache.ErrInvalidKey, key)
+		}
+	}
+	name := filepath.Join(f.root, filepath.FromSlash(key))
+	// 符号链接可能指向根目录之外
+	real, err := filepath.EvalSymlinks(name)
+	if os.IsNotExist(err) {
+		return "", cache.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if real != f.root && !strings.HasPrefix(real, f.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q escapes root", cache.ErrInvalidKey, key)
+	}
+	return real, nil
+}
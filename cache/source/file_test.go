@@ -0,0 +1,42 @@
+package source
+
+import (
+	"cache"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileGetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filegetter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	os.MkdirAll(filepath.Join(root, "scores"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "scores", "Tom"), []byte("630"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644)
+
+	getter := FileGetter(root)
+	if v, err := getter.Get("scores/Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("expect 630, but %s, %v got", v, err)
+	}
+	if _, err := getter.Get("scores/Jack"); err != cache.ErrNotFound {
+		t.Fatalf("expect ErrNotFound, but %v got", err)
+	}
+
+	for _, key := range []string{"../secret", "scores/../../secret", "/etc/passwd", "", "scores\\..\\..\\secret"} {
+		if v, err := getter.Get(key); !errors.Is(err, cache.ErrInvalidKey) {
+			t.Fatalf("expect ErrInvalidKey for %q, but %s, %v got", key, v, err)
+		}
+	}
+	// 指向根目录之外的符号链接
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "link")); err == nil {
+		if v, err := getter.Get("link"); !errors.Is(err, cache.ErrInvalidKey) {
+			t.Fatalf("expect ErrInvalidKey for symlink, but %s, %v got", v, err)
+		}
+	}
+}
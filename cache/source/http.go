@@ -0,0 +1,84 @@
+package source
+
+import (
+	"cache"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPOption 用于修改 HTTPGetter 的默认配置
+type HTTPOption func(*httpGetter)
+
+// 设置 key 到 URL 的模板，模板中的 {key} 会被替换为转义后的 key，
+// 结果拼接在 baseURL 之后。默认为 "{key}"
+func WithURLTemplate(tmpl string) HTTPOption {
+	return func(h *httpGetter) {
+		h.tmpl = tmpl
+	}
+}
+
+// 为每个请求添加请求头，可多次调用
+func WithHeader(key, value string) HTTPOption {
+	return func(h *httpGetter) {
+		h.header.Add(key, value)
+	}
+}
+
+// httpGetter 从 HTTP 服务获取源数据
+type httpGetter struct {
+	baseURL string
+	client  *http.Client
+	tmpl    string
+	header  http.Header
+}
+
+// 返回一个从 HTTP 服务获取源数据的 Getter：GET baseURL+模板生成的路径，返回响应体。
+// 响应为 404 时返回 cache.ErrNotFound，其他非 200 响应返回错误。client 为 nil 时使用 http.DefaultClient
+func HTTPGetter(baseURL string, client *http.Client, opts ...HTTPOption) cache.Getter {
+	h := &httpGetter{
+		baseURL: baseURL,
+		client:  client,
+		tmpl:    "{key}",
+		header:  make(http.Header),
+	}
+	if h.client == nil {
+		h.client = http.DefaultClient
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *httpGetter) Get(key string) ([]byte, error) {
+	u := h.baseURL + strings.Replace(h.tmpl, "{key}", url.PathEscape(key), -1)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, cache.ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("origin returned: %v", res.Status)
+	}
+
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,48 @@
+package source
+
+import (
+	"cache"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPGetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/items/Tom":
+			w.Write([]byte("630"))
+		case "/items/a%2Fb":
+			w.Write([]byte("escaped"))
+		case "/items/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	getter := HTTPGetter(srv.URL, srv.Client(),
+		WithURLTemplate("/items/{key}"), WithHeader("Authorization", "Bearer token"))
+
+	if v, err := getter.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("expect 630, but %s, %v got", v, err)
+	}
+	if v, err := getter.Get("a/b"); err != nil || string(v) != "escaped" {
+		t.Fatalf("expect key escaped, but %s, %v got", v, err)
+	}
+	if _, err := getter.Get("unknown"); err != cache.ErrNotFound {
+		t.Fatalf("expect ErrNotFound, but %v got", err)
+	}
+	if _, err := getter.Get("broken"); err == nil {
+		t.Fatal("expect error on 500")
+	}
+
+	if _, err := HTTPGetter(srv.URL+"/items/", nil).Get("Tom"); err == nil {
+		t.Fatal("expect error without authorization header")
+	}
+}
@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"cache"
+	"context"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 返回一个从 Redis 获取源数据的 Getter：GET keyPrefix+key，key 不存在时返回 cache.ErrNotFound。
+// 单独作为一个模块，避免 cache 依赖 Redis 客户端
+func RedisGetter(client goredis.UniversalClient, keyPrefix string) cache.Getter {
+	return cache.GetterFunc(func(key string) ([]byte, error) {
+		bytes, err := client.Get(context.Background(), keyPrefix+key).Bytes()
+		if err == goredis.Nil {
+			return nil, cache.ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes, nil
+	})
+}
@@ -0,0 +1,30 @@
+package redis
+
+import (
+	"cache"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestRedisGetter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	mr.Set("scores:Tom", "630")
+
+	getter := RedisGetter(client, "scores:")
+	if v, err := getter.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("expect 630, but %s, %v got", v, err)
+	}
+	if _, err := getter.Get("Jack"); err != cache.ErrNotFound {
+		t.Fatalf("expect ErrNotFound, but %v got", err)
+	}
+
+	gee := cache.NewGroup("redis-scores", 2<<10, getter)
+	defer cache.RemoveGroup("redis-scores")
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630 through group, but %v, %v got", v, err)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// StreamingGetter 以流的方式读取数据源中的值，用于无法一次性放入内存的大对象。
+// Group 的 getter 同时实现了该接口并通过 WithStreamThreshold 启用时，
+// 超过阈值的值直接从数据源流式返回给调用方，不经过缓存
+type StreamingGetter interface {
+	GetStream(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// 启用流式读取：getter 实现了 StreamingGetter 时，GetStream 和 ServeHTTP（带上 ?stream=1 的非节点请求）
+// 读取超过 n 字节的值时边读边返回，不缓存；不超过 n 字节的值照常缓存。
+// 节点之间的请求仍然通过 Getter.Get 完整读取。n <= 0 表示不启用
+func WithStreamThreshold(n int64) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.streamThreshold = n
+		}
+	}
+}
+
+// 以流的方式读取 key 的值，调用方需要关闭返回的 ReadCloser。
+// 未启用流式读取、命中缓存、key 属于远程节点或值不超过阈值时，与 GetContext 相同，返回读取缓存值的 reader
+func (g *Group) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := g.stream(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		return rc, nil
+	}
+	v, err := g.GetContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(v.b)), nil
+}
+
+// 只在 key 属于本机、未命中缓存且值超过阈值时返回数据源的流，否则返回 nil，由调用方通过 GetContext 读取：
+// 小的值经过完整的加载流程（singleflight、并发和速率限制、负缓存、Content-Type、备用数据源）后缓存，
+// 代价是第一次读取时数据源被读两次。大对象每次都从数据源读取，不经过 singleflight
+func (g *Group) stream(ctx context.Context, key string) (io.ReadCloser, error) {
+	sg, ok := g.loadGetter().(StreamingGetter)
+	if !ok || g.streamThreshold <= 0 {
+		return nil, nil
+	}
+	key = g.normalize(key)
+	if err := g.checkKey(key); err != nil {
+		return nil, err
+	}
+	if g.peers != nil {
+		if _, ok := g.peers.PickPeer(key); ok {
+			return nil, nil
+		}
+	}
+	if _, _, ok := g.lookupCache(key); ok {
+		return nil, nil
+	}
+	// 已知不存在的 key 不打开流，由 GetContext 返回原来的错误
+	if f := g.bloomFilter(); f != nil && !f.MayContain(key) {
+		return nil, nil
+	}
+	if g.negative != nil && g.negative.get(key) != nil {
+		return nil, nil
+	}
+
+	rc, err := sg.GetStream(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// 多读一个字节判断是否超过阈值
+	head, err := ioutil.ReadAll(io.LimitReader(rc, g.streamThreshold+1))
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if int64(len(head)) <= g.streamThreshold {
+		rc.Close()
+		return nil, nil
+	}
+	g.Stats.Misses.Add(1)
+	return &streamReader{Reader: io.MultiReader(bytes.NewReader(head), rc), Closer: rc}, nil
+}
+
+// streamReader 先返回已经读取的部分，再继续读取数据源的流，关闭时关闭数据源的流
+type streamReader struct {
+	io.Reader
+	io.Closer
+}
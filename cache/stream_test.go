@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"bytes"
+	pb "cache/geecachepb"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// patternReader 生成 n 字节的 0..255 循环序列，记录已经读取的字节数
+type patternReader struct {
+	off, n int64
+	read   *int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n-r.off {
+		p = p[:r.n-r.off]
+	}
+	for i := range p {
+		p[i] = byte(r.off + int64(i))
+	}
+	r.off += int64(len(p))
+	atomic.AddInt64(r.read, int64(len(p)))
+	return len(p), nil
+}
+
+func (r *patternReader) Close() error { return nil }
+
+// streamSource 中 big 开头的 key 为 8MB，其他 key 为 key 本身
+type streamSource struct {
+	read int64
+}
+
+func (s *streamSource) size(key string) int64 {
+	if strings.HasPrefix(key, "big") {
+		return 8 << 20
+	}
+	return int64(len(key))
+}
+
+func (s *streamSource) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(key, "big") {
+		return ioutil.NopCloser(strings.NewReader(key)), nil
+	}
+	return &patternReader{n: s.size(key), read: &s.read}, nil
+}
+
+func (s *streamSource) Get(key string) ([]byte, error) {
+	rc, _ := s.GetStream(context.Background(), key)
+	return ioutil.ReadAll(rc)
+}
+
+func expectPattern(t *testing.T, r io.Reader, n int64) {
+	t.Helper()
+	want := &patternReader{n: n, read: new(int64)}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBytes, _ := ioutil.ReadAll(want)
+	if !bytes.Equal(got, wantBytes) {
+		t.Fatalf("expect %d bytes of pattern, but %d bytes got", n, len(got))
+	}
+}
+
+func TestGetStream(t *testing.T) {
+	src := &streamSource{}
+	gee := NewGroup("getstream", 2<<10, src, WithStreamThreshold(64<<10))
+	defer RemoveGroup("getstream")
+
+	rc, err := gee.GetStream(context.Background(), "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只读取了判断是否超过阈值的部分
+	if read := atomic.LoadInt64(&src.read); read > 64<<10+1 {
+		t.Fatalf("expect at most threshold+1 bytes buffered, but %d read", read)
+	}
+	expectPattern(t, rc, 8<<20)
+	rc.Close()
+	if _, entries := gee.Size(); entries != 0 {
+		t.Fatalf("expect large value not cached, but %d entries got", entries)
+	}
+
+	rc, err = gee.GetStream(context.Background(), "Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(rc); string(b) != "Tom" {
+		t.Fatalf("expect Tom, but %s got", b)
+	}
+	if _, ok := gee.GetIfPresent("Tom"); !ok {
+		t.Fatal("expect small value cached")
+	}
+}
+
+// 同时返回 Content-Type 的 streamSource
+type typedStreamSource struct {
+	streamSource
+	loads int32
+}
+
+func (s *typedStreamSource) GetTyped(key string) ([]byte, string, error) {
+	atomic.AddInt32(&s.loads, 1)
+	b, err := s.Get(key)
+	return b, "text/plain", err
+}
+
+func TestGetStreamSmallValueLoads(t *testing.T) {
+	src := &typedStreamSource{}
+	gee := NewGroup("getstream-small", 2<<10, src, WithStreamThreshold(64<<10))
+	defer RemoveGroup("getstream-small")
+
+	// 小的值经过正常的加载流程，保留 Content-Type
+	rc, err := gee.GetStream(context.Background(), "Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if v, ok := gee.GetIfPresent("Tom"); !ok || v.ContentType() != "text/plain" {
+		t.Fatalf("expect Tom cached as text/plain, but %q, %v got", v.ContentType(), ok)
+	}
+	if n := atomic.LoadInt32(&src.loads); n != 1 {
+		t.Fatalf("expect one load through the getter, but %d got", n)
+	}
+}
+
+func TestServeHTTPStream(t *testing.T) {
+	src := &streamSource{}
+	NewGroup("servestream", 2<<10, src, WithStreamThreshold(64<<10))
+	defer RemoveGroup("servestream")
+	srv := httptest.NewServer(NewHTTPPool("http://localhost:8001", WithPoolLogger(NopLogger{})))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/_cache/servestream/big?stream=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("expect streamed response, but %d, %s got", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	expectPattern(t, res.Body, 8<<20)
+	if n := GetGroup("servestream").Stats.Misses.Get(); n != 1 {
+		t.Fatalf("expect 1 miss, but %d got", n)
+	}
+	if _, entries := GetGroup("servestream").Size(); entries != 0 {
+		t.Fatalf("expect large value not cached, but %d entries got", entries)
+	}
+
+	// 小的值同样返回原始的值
+	small, err := http.Get(srv.URL + "/_cache/servestream/Tom?stream=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer small.Body.Close()
+	if body, _ := ioutil.ReadAll(small.Body); string(body) != "Tom" {
+		t.Fatalf("expect raw Tom, but %q got", body)
+	}
+
+	// 不带参数的请求（包括不带 Accept 的旧版本节点）得到 protobuf 响应，不会流式写入
+	legacy, err := http.Get(srv.URL + "/_cache/servestream/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Body.Close()
+	body, _ := ioutil.ReadAll(legacy.Body)
+	out := &pb.Response{}
+	if err := ProtobufCodec.Unmarshal(body, out); err != nil {
+		t.Fatalf("expect protobuf response, but %v got", err)
+	}
+	expectPattern(t, bytes.NewReader(out.Value), 8<<20)
+
+	// 节点之间的请求仍然完整读取
+	peer := &httpGetter{baseURL: srv.URL + "/_cache/", client: http.DefaultClient}
+	out = &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "servestream", Key: "big"}, out); err != nil {
+		t.Fatal(err)
+	}
+	expectPattern(t, bytes.NewReader(out.Value), 8<<20)
+}
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 标签索引：记录每个标签下的 key 和每个 key 的标签，由 cache 在记录添加和离开缓存时维护
+type tagIndex struct {
+	mu sync.Mutex
+	// 标签到带有该标签的 key 的集合
+	keys map[string]map[string]struct{}
+	// key 到它的标签
+	tags map[string][]string
+}
+
+// 延迟创建的标签索引：第一次 SetWithTags 时才创建，没有使用过标签的缓存淘汰记录时不需要维护索引。
+// cache 的各个分片引用父缓存的同一个 lazyTags，因此共用同一个索引
+type lazyTags struct {
+	once sync.Once
+	// *tagIndex，创建之前为 nil
+	index atomic.Value
+}
+
+// 返回已经创建的索引，还没有创建时返回 nil
+func (l *lazyTags) load() *tagIndex {
+	t, _ := l.index.Load().(*tagIndex)
+	return t
+}
+
+// 返回索引，第一次调用时创建
+func (l *lazyTags) create() *tagIndex {
+	l.once.Do(func() {
+		l.index.Store(newTagIndex())
+	})
+	return l.load()
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		keys: make(map[string]map[string]struct{}),
+		tags: make(map[string][]string),
+	}
+}
+
+// 把 key 的标签替换为 tags
+func (t *tagIndex) set(key string, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+		if _, ok := keys[key]; ok {
+			// 重复的标签
+			continue
+		}
+		keys[key] = struct{}{}
+		t.tags[key] = append(t.tags[key], tag)
+	}
+}
+
+// 删除 key 的全部标签
+func (t *tagIndex) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+}
+
+func (t *tagIndex) removeLocked(key string) {
+	for _, tag := range t.tags[key] {
+		keys := t.keys[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+	delete(t.tags, key)
+}
+
+// 取出带有 tag 的全部 key（按字典序），并从索引中删除这些 key 的全部标签
+func (t *tagIndex) take(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.keys[tag]))
+	for key := range t.keys[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		t.removeLocked(key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"cache/lru"
+	"cache/twoqueue"
+	"reflect"
+	"testing"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	for name, opts := range map[string][]GroupOption{
+		"single":  nil,
+		"sharded": {WithCacheShards(4)},
+		// 自定义淘汰算法不报告值被替换
+		"twoqueue": {WithPolicy(func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+			return twoqueue.New(maxBytes, onEvicted)
+		})},
+	} {
+		loads := 0
+		gee := NewGroup("invalidatetag-"+name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads++
+				return []byte("fresh " + key), nil
+			}), opts...)
+		defer RemoveGroup("invalidatetag-" + name)
+
+		gee.SetWithTags("profile:1", []byte("Tom"), "user:1")
+		gee.SetWithTags("feed:1", []byte("Tom's feed"), "user:1", "feed")
+		gee.SetWithTags("profile:2", []byte("Jack"), "user:2")
+
+		if keys := gee.InvalidateTag("user:1"); !reflect.DeepEqual(keys, []string{"feed:1", "profile:1"}) {
+			t.Fatalf("%s: expect both user:1 fragments invalidated, but %v got", name, keys)
+		}
+		for _, key := range []string{"profile:1", "feed:1"} {
+			if v, err := gee.Get(key); err != nil || v.String() != "fresh "+key {
+				t.Fatalf("%s: expect %s reloaded, but %s, %v got", name, key, v, err)
+			}
+		}
+		if v, ok := gee.GetIfPresent("profile:2"); !ok || v.String() != "Jack" {
+			t.Fatalf("%s: expect profile:2 untouched, but %s, %v got", name, v, ok)
+		}
+		if loads != 2 {
+			t.Fatalf("%s: expect 2 reloads, but %d got", name, loads)
+		}
+		// feed:1 的其他标签也随之清除，重新加载的记录不带标签
+		if keys := gee.InvalidateTag("feed"); len(keys) != 0 {
+			t.Fatalf("%s: expect no keys left under feed, but %v got", name, keys)
+		}
+
+		// 被替换的记录不再带有原来的标签
+		gee.Set("profile:2", []byte("Jack v2"))
+		if keys := gee.InvalidateTag("user:2"); len(keys) != 0 {
+			t.Fatalf("%s: expect replaced entry untagged, but %v got", name, keys)
+		}
+	}
+}
+
+func TestTagIndexEviction(t *testing.T) {
+	gee := NewGroup("tagindexeviction", 30, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	defer RemoveGroup("tagindexeviction")
+
+	// 没有使用过标签时不创建索引
+	gee.Set("k0", []byte("0"))
+	if gee.mainCache.loadTags() != nil {
+		t.Fatal("expect no tag index before SetWithTags")
+	}
+	if keys := gee.InvalidateTag("t"); len(keys) != 0 {
+		t.Fatalf("expect no keys without an index, but %v got", keys)
+	}
+
+	gee.SetWithTags("k1", []byte("0123456789"), "t")
+	gee.SetWithTags("k2", []byte("0123456789"), "t")
+	// 超过容量，淘汰最久未使用的 k1
+	gee.Set("k3", []byte("0123456789"))
+	if _, ok := gee.GetIfPresent("k1"); ok {
+		t.Fatal("expect k1 evicted")
+	}
+	if tags := gee.mainCache.loadTags().tags; len(tags) != 1 || tags["k2"] == nil {
+		t.Fatalf("expect only k2 indexed after eviction, but %v got", tags)
+	}
+	if keys := gee.InvalidateTag("t"); !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("expect only k2 under t, but %v got", keys)
+	}
+
+	// 超过容量、没有缓存的记录不建立索引
+	gee.SetWithTags("big", make([]byte, 100), "t")
+	if tags := gee.mainCache.loadTags().tags; len(tags) != 0 {
+		t.Fatalf("expect uncached key not indexed, but %v got", tags)
+	}
+
+	gee.SetWithTags("k4", []byte("4"), "t")
+	gee.mainCache.clear()
+	if tags := gee.mainCache.loadTags(); len(tags.tags) != 0 || len(tags.keys) != 0 {
+		t.Fatal("expect index emptied by clear")
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 数据源在限定时间内没有返回时的错误，使用 errors.Is 判断
+var ErrGetterTimeout = errors.New("getter timed out")
+
+// TimeoutGetter 限制 g.Get 的执行时间，超过 d 时返回 ErrGetterTimeout。
+// 超时后底层的 Get 仍在单独的 goroutine 中运行直到返回，结果被丢弃；
+// 若 getter 可能永远阻塞（不响应任何取消），这些 goroutine 会一直泄漏。
+// 返回值保留 g 实现的 TypedGetter、StreamingGetter 和 WriteThrough：GetTyped 同样限时，
+// GetStream 只限制打开流的时间，不限制读取；Put 不限时，超时的写入之后仍可能成功，会使缓存与数据源不一致
+func TimeoutGetter(g Getter, d time.Duration) Getter {
+	t := &timeoutGetter{g: g, d: d}
+	w, isWriter := g.(WriteThrough)
+	sg, isStreamer := g.(StreamingGetter)
+	stream := timeoutStream{sg: sg, d: d}
+	switch {
+	case isWriter && isStreamer:
+		return struct {
+			*timeoutGetter
+			timeoutStream
+			WriteThrough
+		}{t, stream, w}
+	case isWriter:
+		return struct {
+			*timeoutGetter
+			WriteThrough
+		}{t, w}
+	case isStreamer:
+		return struct {
+			*timeoutGetter
+			timeoutStream
+		}{t, stream}
+	}
+	return t
+}
+
+// timeoutGetter 实现了 Getter 和 TypedGetter，g 没有实现 TypedGetter 时 Content-Type 为空，与直接使用 g 相同
+type timeoutGetter struct {
+	g Getter
+	d time.Duration
+}
+
+func (t *timeoutGetter) Get(key string) ([]byte, error) {
+	b, _, err := t.GetTyped(key)
+	return b, err
+}
+
+func (t *timeoutGetter) GetTyped(key string) ([]byte, string, error) {
+	type result struct {
+		b   []byte
+		ct  string
+		err error
+	}
+	// 带缓冲，超时之后 goroutine 仍然可以写入并退出
+	ch := make(chan result, 1)
+	go func() {
+		b, ct, err := getTyped(t.g, key)
+		ch <- result{b, ct, err}
+	}()
+
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.b, r.ct, r.err
+	case <-timer.C:
+		return nil, "", fmt.Errorf("get %s after %v: %w", key, t.d, ErrGetterTimeout)
+	}
+}
+
+// timeoutStream 限制打开流的时间，超时时取消传给底层 GetStream 的 ctx，之后返回的流会被关闭
+type timeoutStream struct {
+	sg StreamingGetter
+	d  time.Duration
+}
+
+func (t timeoutStream) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	type result struct {
+		rc  io.ReadCloser
+		err error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan result, 1)
+	go func() {
+		rc, err := t.sg.GetStream(ctx, key)
+		ch <- result{rc, err}
+	}()
+
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			cancel()
+			return nil, r.err
+		}
+		// 流读取完之前 ctx 必须保持有效，关闭流时再释放
+		return &streamReader{Reader: r.rc, Closer: cancelCloser{r.rc, cancel}}, nil
+	case <-timer.C:
+		cancel()
+		go func() {
+			if r := <-ch; r.rc != nil {
+				r.rc.Close()
+			}
+		}()
+		return nil, fmt.Errorf("stream %s after %v: %w", key, t.d, ErrGetterTimeout)
+	}
+}
+
+// 关闭流之后取消对应的 ctx
+type cancelCloser struct {
+	io.Closer
+	cancel context.CancelFunc
+}
+
+func (c cancelCloser) Close() error {
+	err := c.Closer.Close()
+	c.cancel()
+	return err
+}
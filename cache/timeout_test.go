@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutGetter(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			<-release
+		}
+		return []byte(key), nil
+	})
+	g := TimeoutGetter(slow, 20*time.Millisecond)
+
+	if v, err := g.Get("fast"); err != nil || string(v) != "fast" {
+		t.Fatalf("expect fast, but %q, %v got", v, err)
+	}
+	start := time.Now()
+	if _, err := g.Get("slow"); !errors.Is(err, ErrGetterTimeout) {
+		t.Fatalf("expect ErrGetterTimeout, but %v got", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect timeout after 20ms, but returned after %v", d)
+	}
+
+	gee := NewGroup("timeoutgetter", 2<<10, g)
+	defer RemoveGroup("timeoutgetter")
+	if _, err := gee.Get("slow"); !errors.Is(err, ErrGetterTimeout) {
+		t.Fatalf("expect ErrGetterTimeout from group, but %v got", err)
+	}
+}
+
+// 同时实现了 TypedGetter、StreamingGetter 和 WriteThrough 的数据源
+type fullStore struct {
+	release chan struct{}
+	puts    []string
+}
+
+func (s *fullStore) Get(key string) ([]byte, error) {
+	b, _, err := s.GetTyped(key)
+	return b, err
+}
+
+func (s *fullStore) GetTyped(key string) ([]byte, string, error) {
+	if key == "slow" {
+		<-s.release
+	}
+	return []byte(key), "text/plain", nil
+}
+
+func (s *fullStore) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == "slow" {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return ioutil.NopCloser(strings.NewReader(key)), nil
+}
+
+func (s *fullStore) Put(key string, value []byte) error {
+	s.puts = append(s.puts, key)
+	return nil
+}
+
+func TestTimeoutGetterForwards(t *testing.T) {
+	store := &fullStore{release: make(chan struct{})}
+	defer close(store.release)
+	g := TimeoutGetter(store, 20*time.Millisecond)
+
+	tg, ok := g.(TypedGetter)
+	if !ok {
+		t.Fatal("expect TypedGetter forwarded")
+	}
+	if v, ct, err := tg.GetTyped("Tom"); err != nil || string(v) != "Tom" || ct != "text/plain" {
+		t.Fatalf("expect Tom as text/plain, but %q, %q, %v got", v, ct, err)
+	}
+	if _, _, err := tg.GetTyped("slow"); !errors.Is(err, ErrGetterTimeout) {
+		t.Fatalf("expect ErrGetterTimeout from GetTyped, but %v got", err)
+	}
+
+	sg, ok := g.(StreamingGetter)
+	if !ok {
+		t.Fatal("expect StreamingGetter forwarded")
+	}
+	rc, err := sg.GetStream(context.Background(), "Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(rc); string(b) != "Tom" {
+		t.Fatalf("expect Tom streamed, but %q got", b)
+	}
+	rc.Close()
+	if _, err := sg.GetStream(context.Background(), "slow"); !errors.Is(err, ErrGetterTimeout) {
+		t.Fatalf("expect ErrGetterTimeout from GetStream, but %v got", err)
+	}
+
+	w, ok := g.(WriteThrough)
+	if !ok {
+		t.Fatal("expect WriteThrough forwarded")
+	}
+	if err := w.Put("Tom", []byte("630")); err != nil || len(store.puts) != 1 {
+		t.Fatalf("expect Put forwarded, but %v, %v got", err, store.puts)
+	}
+
+	// 没有实现的接口不会出现在返回值上
+	plain := TimeoutGetter(GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), time.Second)
+	if _, ok := plain.(WriteThrough); ok {
+		t.Fatal("expect no WriteThrough for a plain getter")
+	}
+	if _, ok := plain.(StreamingGetter); ok {
+		t.Fatal("expect no StreamingGetter for a plain getter")
+	}
+}
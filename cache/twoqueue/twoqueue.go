@@ -0,0 +1,180 @@
+package twoqueue
+
+import (
+	"cache/lru"
+	"container/list"
+)
+
+// 2Q 缓存：新记录先进入 A1in（FIFO），再次访问才晋升到 Am（LRU）。
+// 从 A1in 淘汰的 key 记录在 A1out（只保存 key），短时间内再次添加时直接进入 Am。
+// 只访问一次的记录（如扫描）只会在 A1in 中被淘汰，不会挤掉 Am 中的热点记录。当前非线程安全
+type Cache struct {
+	maxBytes int64
+	// A1in 和 Am 的总字节数
+	nbytes int64
+	// A1in 的字节数及其上限
+	inBytes, inMaxBytes int64
+	// A1out 中 key 的总字节数及其上限，不计入 maxBytes
+	outBytes, outMaxBytes int64
+	// 首次访问的记录，FIFO
+	in *list.List
+	// 从 A1in 淘汰的 key
+	out *list.List
+	// 多次访问的记录，LRU
+	am *list.List
+	// 记录所在的 A1in 或 Am 元素
+	cache map[string]*list.Element
+	// A1out 中的元素
+	ghosts map[string]*list.Element
+	// 可选的方法（回调作用）
+	OnEvicted func(key string, value lru.Value)
+}
+
+type entry struct {
+	key   string
+	value lru.Value
+	// 是否在 Am 中
+	hot bool
+}
+
+// A1in 占 maxBytes 的 1/4，A1out 最多保存 maxBytes/2 字节的 key
+func New(maxBytes int64, onEvicted func(string, lru.Value)) *Cache {
+	return &Cache{
+		maxBytes:    maxBytes,
+		inMaxBytes:  maxBytes / 4,
+		outMaxBytes: maxBytes / 2,
+		in:          list.New(),
+		out:         list.New(),
+		am:          list.New(),
+		cache:       make(map[string]*list.Element),
+		ghosts:      make(map[string]*list.Element),
+		OnEvicted:   onEvicted,
+	}
+}
+
+// 添加值到缓存中
+func (c *Cache) Add(key string, value lru.Value) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		if !kv.hot {
+			c.inBytes += int64(value.Len()) - int64(kv.value.Len())
+		}
+		kv.value = value
+		c.promote(ele)
+	} else {
+		kv := &entry{key: key, value: value}
+		size := int64(len(key)) + int64(value.Len())
+		if ghost, ok := c.ghosts[key]; ok {
+			// 最近被淘汰过，说明不是一次性访问，直接进入 Am
+			c.removeGhost(ghost)
+			kv.hot = true
+			c.cache[key] = c.am.PushFront(kv)
+		} else {
+			c.cache[key] = c.in.PushFront(kv)
+			c.inBytes += size
+		}
+		c.nbytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// 从缓存中获取值，A1in 中的记录被再次访问时晋升到 Am
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		c.promote(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// 淘汰一条记录：A1in 超过上限或 Am 为空时淘汰 A1in 最早的记录并记入 A1out，否则淘汰 Am 最久未使用的记录
+func (c *Cache) RemoveOldest() {
+	if c.in.Len() > 0 && (c.inBytes > c.inMaxBytes || c.am.Len() == 0) {
+		ele := c.in.Back()
+		c.removeElement(ele)
+		c.addGhost(ele.Value.(*entry).key)
+		return
+	}
+	if ele := c.am.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// 删除指定的缓存，会触发 OnEvicted
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+	if ghost, ok := c.ghosts[key]; ok {
+		c.removeGhost(ghost)
+	}
+}
+
+// 先遍历 Am（从最近使用到最久未使用），再遍历 A1in（从新到旧），f 返回 false 时停止。
+// 调用方需自行加锁，且 f 中不能修改 Cache
+func (c *Cache) Range(f func(key string, value lru.Value) bool) {
+	for _, l := range []*list.List{c.am, c.in} {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if !f(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// 缓存中的记录数，不包括 A1out
+func (c *Cache) Len() int {
+	return c.in.Len() + c.am.Len()
+}
+
+// 将记录移动到 Am 的队头
+func (c *Cache) promote(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.hot {
+		c.am.MoveToFront(ele)
+		return
+	}
+	c.in.Remove(ele)
+	c.inBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	kv.hot = true
+	c.cache[kv.key] = c.am.PushFront(kv)
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	size := int64(len(kv.key)) + int64(kv.value.Len())
+	if kv.hot {
+		c.am.Remove(ele)
+	} else {
+		c.in.Remove(ele)
+		c.inBytes -= size
+	}
+	delete(c.cache, kv.key)
+	c.nbytes -= size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) addGhost(key string) {
+	c.ghosts[key] = c.out.PushFront(key)
+	c.outBytes += int64(len(key))
+	for c.outBytes > c.outMaxBytes && c.out.Len() > 0 {
+		c.removeGhost(c.out.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	key := c.out.Remove(ele).(string)
+	delete(c.ghosts, key)
+	c.outBytes -= int64(len(key))
+}
+
+// A1in 和 Am 中记录占用的总字节数，不包括 A1out
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,85 @@
+package twoqueue
+
+import (
+	"cache/lru"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+// 扫描只会淘汰 A1in 中的记录，被访问过两次的热点记录保留在 Am 中
+func TestScanResistance(t *testing.T) {
+	const capacity = 100
+	q := New(capacity, nil)
+	l := lru.New(capacity, nil)
+	hot := []string{"h1", "h2", "h3"}
+	for _, k := range hot {
+		q.Add(k, String("v"))
+		q.Get(k)
+		l.Add(k, String("v"))
+		l.Get(k)
+	}
+
+	for i := 0; i < 100; i++ {
+		k := "s" + strconv.Itoa(i)
+		q.Add(k, String("v"))
+		l.Add(k, String("v"))
+	}
+
+	for _, k := range hot {
+		if _, ok := q.Get(k); !ok {
+			t.Fatalf("expect hot key %s to survive the scan under 2Q", k)
+		}
+		if _, ok := l.Get(k); ok {
+			t.Fatalf("expect hot key %s evicted under plain LRU", k)
+		}
+	}
+	if q.nbytes > capacity {
+		t.Fatalf("expect nbytes <= %d, but %d got", capacity, q.nbytes)
+	}
+}
+
+func TestGhostPromotion(t *testing.T) {
+	keys := make([]string, 0)
+	q := New(int64(16), func(key string, value lru.Value) {
+		keys = append(keys, key)
+	})
+	q.Add("k1", String("v1"))
+	q.Add("k2", String("v2"))
+	q.Add("k3", String("v3"))
+	q.Add("k4", String("v4"))
+	q.Add("k5", String("v5"))
+
+	if !reflect.DeepEqual(keys, []string{"k1"}) {
+		t.Fatalf("expect k1 evicted from A1in, but %v got", keys)
+	}
+	if _, ok := q.ghosts["k1"]; !ok {
+		t.Fatal("expect k1 remembered in A1out")
+	}
+
+	// 最近被淘汰过的 key 再次添加时直接进入 Am
+	q.Add("k1", String("v1"))
+	if ele := q.cache["k1"]; !ele.Value.(*entry).hot {
+		t.Fatal("expect k1 added to Am")
+	}
+	if q.Len() != 4 {
+		t.Fatalf("expect 4 entries, but %d got", q.Len())
+	}
+}
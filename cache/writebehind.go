@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// 写后缓冲区最多缓冲的写入数，缓冲区满时 Set 等待
+const writeBehindBuffer = 1024
+
+// 一次等待写入数据源的 Set，store 是放入缓冲区时的数据源，之后替换 getter 也不影响。
+// version 区分不同的数据源，见 Group.getterVersion
+type pendingWrite struct {
+	store   WriteThrough
+	version uint64
+	key     string
+	value   []byte
+}
+
+// 合并写入的依据：同一个数据源的同一个 key。数据源本身不一定可以比较，用 version 代替
+type pendingKey struct {
+	version uint64
+	key     string
+}
+
+// writeBehind 在后台把 Set 的值写入数据源：Set 把值放入缓冲 channel 后立即返回，后台 goroutine
+// 合并同一个数据源的同一个 key 的多次写入（只写最后一次的值），每隔 interval 或积累了 batchSize 个 key 时按第一次写入的顺序依次调用 Put
+type writeBehind struct {
+	interval  time.Duration
+	batchSize int
+	// Put 失败时调用，在后台 goroutine 中执行
+	onError func(key string, err error)
+
+	writes chan pendingWrite
+	// 请求立即写入，写入完成后关闭收到的 channel
+	flushes chan chan struct{}
+	// 保护 stopped：stop 等待正在放入缓冲区的写入完成，之后的写入不再进入缓冲区
+	mu      sync.RWMutex
+	stopped bool
+	// 关闭后后台 goroutine 写完剩余的值并退出
+	done chan struct{}
+	// 后台 goroutine 退出后关闭
+	exited chan struct{}
+}
+
+func newWriteBehind(interval time.Duration, batchSize int, onError func(key string, err error)) *writeBehind {
+	return &writeBehind{
+		interval:  interval,
+		batchSize: batchSize,
+		onError:   onError,
+		writes:    make(chan pendingWrite, writeBehindBuffer),
+		flushes:   make(chan chan struct{}),
+		done:      make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+}
+
+// 启动后台 goroutine
+func (w *writeBehind) start() {
+	go w.run()
+}
+
+// 把写入放入缓冲区，已经 stop 时返回 false，由调用方直接写入数据源
+func (w *writeBehind) enqueue(store WriteThrough, version uint64, key string, value []byte) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.stopped {
+		return false
+	}
+	w.writes <- pendingWrite{store: store, version: version, key: key, value: value}
+	return true
+}
+
+// 立即写入已经放入缓冲区的全部值，写入完成后返回。已经 stop 时直接返回
+func (w *writeBehind) flush() {
+	reply := make(chan struct{})
+	select {
+	case w.flushes <- reply:
+		<-reply
+	case <-w.exited:
+	}
+}
+
+// 停止接受新的写入，等待后台 goroutine 写完剩余的值。可以多次调用
+func (w *writeBehind) stop() {
+	w.mu.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.done)
+	}
+	w.mu.Unlock()
+	<-w.exited
+}
+
+func (w *writeBehind) run() {
+	defer close(w.exited)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	pending := make(map[pendingKey]pendingWrite)
+	var order []pendingKey
+	add := func(op pendingWrite) {
+		k := pendingKey{op.version, op.key}
+		if _, ok := pending[k]; !ok {
+			order = append(order, k)
+		}
+		pending[k] = op
+	}
+	// 取出缓冲区中已有的全部写入
+	drain := func() {
+		for {
+			select {
+			case op := <-w.writes:
+				add(op)
+			default:
+				return
+			}
+		}
+	}
+	write := func() {
+		for _, k := range order {
+			op := pending[k]
+			if err := op.store.Put(op.key, op.value); err != nil {
+				w.onError(op.key, err)
+			}
+		}
+		pending = make(map[pendingKey]pendingWrite)
+		order = nil
+	}
+
+	for {
+		select {
+		case op := <-w.writes:
+			add(op)
+			if w.batchSize > 0 && len(order) >= w.batchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case reply := <-w.flushes:
+			drain()
+			write()
+			close(reply)
+		case <-w.done:
+			// stop 之后不会再有新的写入进入缓冲区
+			drain()
+			write()
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次 Put 的数据源
+type recordStore struct {
+	mu     sync.Mutex
+	values map[string]string
+	puts   map[string]int
+	err    error
+}
+
+func newRecordStore() *recordStore {
+	return &recordStore{values: make(map[string]string), puts: make(map[string]int)}
+}
+
+func (s *recordStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.values[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *recordStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.values[key] = string(value)
+	s.puts[key]++
+	return nil
+}
+
+func (s *recordStore) value(key string) (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key], s.puts[key]
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := newRecordStore()
+	gee := NewGroup("writebehind", 2<<10, store, WithWriteBehind(10*time.Millisecond, 0))
+	defer RemoveGroup("writebehind")
+
+	if err := gee.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	// 立即可以从缓存读到
+	if v, ok := gee.GetIfPresent("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("expect 630 cached, but %s, %v got", v, ok)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := store.value("Tom"); v == "630" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect Tom eventually persisted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteBehindCoalesce(t *testing.T) {
+	store := newRecordStore()
+	gee := NewGroup("writebehind-coalesce", 2<<10, store, WithWriteBehind(time.Hour, 0))
+	defer RemoveGroup("writebehind-coalesce")
+
+	for i := 0; i < 10; i++ {
+		gee.Set("Tom", []byte(strconv.Itoa(i)))
+	}
+	if _, puts := store.value("Tom"); puts != 0 {
+		t.Fatalf("expect no puts before flush, but %d got", puts)
+	}
+	gee.Flush()
+	if v, puts := store.value("Tom"); v != "9" || puts != 1 {
+		t.Fatalf("expect one put of the last value, but %s, %d got", v, puts)
+	}
+}
+
+func TestWriteBehindBatchSize(t *testing.T) {
+	store := newRecordStore()
+	gee := NewGroup("writebehind-batch", 2<<10, store, WithWriteBehind(time.Hour, 2))
+	defer RemoveGroup("writebehind-batch")
+
+	gee.Set("Tom", []byte("630"))
+	gee.Set("Jack", []byte("589"))
+	deadline := time.Now().Add(time.Second)
+	for {
+		tom, _ := store.value("Tom")
+		jack, _ := store.value("Jack")
+		if tom == "630" && jack == "589" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expect a full batch written without waiting for the interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteBehindDrainOnRemove(t *testing.T) {
+	store := newRecordStore()
+	gee := NewGroup("writebehind-drain", 2<<10, store, WithWriteBehind(time.Hour, 0))
+	for i := 0; i < 100; i++ {
+		gee.Set("key"+strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	RemoveGroup("writebehind-drain")
+	for i := 0; i < 100; i++ {
+		if v, puts := store.value("key" + strconv.Itoa(i)); v != strconv.Itoa(i) || puts != 1 {
+			t.Fatalf("expect key%d drained on remove, but %s, %d got", i, v, puts)
+		}
+	}
+
+	// 停止之后直接写入数据源
+	if err := gee.Set("late", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := store.value("late"); v != "1" {
+		t.Fatalf("expect write after stop persisted synchronously, but %q got", v)
+	}
+	gee.Flush()
+}
+
+func TestWriteBehindFailures(t *testing.T) {
+	store := newRecordStore()
+	store.err = errors.New("disk full")
+	gee := NewGroup("writebehind-failures", 2<<10, store, WithWriteBehind(time.Hour, 0), WithGroupLogger(NopLogger{}))
+	defer RemoveGroup("writebehind-failures")
+
+	if err := gee.Set("Tom", []byte("630")); err != nil {
+		t.Fatalf("expect Set to return before writing, but %v got", err)
+	}
+	gee.Flush()
+	if n := gee.Stats.WriteBehindFailures.Get(); n != 1 {
+		t.Fatalf("expect 1 failure, but %d got", n)
+	}
+}
+
+func TestWriteBehindSetGetter(t *testing.T) {
+	old := newRecordStore()
+	gee := NewGroup("writebehind-setgetter", 2<<10, old, WithWriteBehind(time.Hour, 0))
+	defer RemoveGroup("writebehind-setgetter")
+
+	// 缓冲的值写入放入缓冲区时的数据源，换成只读的 getter 也不会丢失
+	gee.Set("Tom", []byte("630"))
+	gee.SetGetter(GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	gee.Set("Jack", []byte("589"))
+	gee.Flush()
+	if v, n := old.value("Tom"); v != "630" || n != 1 {
+		t.Fatalf("expect Tom persisted to the old store, but %q, %d puts got", v, n)
+	}
+	if _, n := old.value("Jack"); n != 0 {
+		t.Fatalf("expect Jack not persisted without WriteThrough, but %d puts got", n)
+	}
+
+	// 替换前后写入同一个 key 的值分别写入各自的数据源，不会合并
+	a, b := newRecordStore(), newRecordStore()
+	gee.SetGetter(a)
+	gee.Set("Sam", []byte("567"))
+	gee.SetGetter(b)
+	gee.Set("Sam", []byte("568"))
+	gee.Flush()
+	if v, n := a.value("Sam"); v != "567" || n != 1 {
+		t.Fatalf("expect 567 persisted to the first store, but %q, %d puts got", v, n)
+	}
+	if v, n := b.value("Sam"); v != "568" || n != 1 {
+		t.Fatalf("expect 568 persisted to the second store, but %q, %d puts got", v, n)
+	}
+
+	// 创建时的 getter 没有实现 WriteThrough，之后换成实现了的 getter 同样在后台写入
+	gee = NewGroup("writebehind-setgetter-late", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithWriteBehind(time.Hour, 0))
+	defer RemoveGroup("writebehind-setgetter-late")
+	store := newRecordStore()
+	gee.SetGetter(store)
+	gee.Set("Sam", []byte("567"))
+	if _, n := store.value("Sam"); n != 0 {
+		t.Fatalf("expect Sam buffered, but %d puts got", n)
+	}
+	gee.Flush()
+	if v, n := store.value("Sam"); v != "567" || n != 1 {
+		t.Fatalf("expect Sam persisted after Flush, but %q, %d puts got", v, n)
+	}
+}